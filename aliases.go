@@ -0,0 +1,106 @@
+package portmidi
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Aliases is a persistent store of friendly names for devices, e.g. "drums", mapped to
+// device keys. It is saved as a JSON object of aliases and keys in the text form.
+type Aliases struct {
+	mux  sync.Mutex
+	path string
+	keys map[string]DeviceKey
+}
+
+// DefaultAliasesPath returns the path of the aliases file in the user config directory.
+func DefaultAliasesPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "portmidi", "aliases.json"), nil
+}
+
+// LoadAliases reads the aliases from the file at path,
+// a missing file gives an empty store that is created on Save.
+func LoadAliases(path string) (*Aliases, error) {
+	a := &Aliases{
+		path: path,
+		keys: make(map[string]DeviceKey),
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return a, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &a.keys); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Get returns the key for the alias.
+func (a *Aliases) Get(alias string) (DeviceKey, bool) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	k, ok := a.keys[alias]
+	return k, ok
+}
+
+// Set maps the alias to the key, replacing the previous key if any.
+func (a *Aliases) Set(alias string, key DeviceKey) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	a.keys[alias] = key
+}
+
+// Delete removes the alias.
+func (a *Aliases) Delete(alias string) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	delete(a.keys, alias)
+}
+
+// Names returns the sorted list of aliases.
+func (a *Aliases) Names() []string {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	names := make([]string, 0, len(a.keys))
+	for name := range a.keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Save writes the aliases to the file they have been loaded from, creating its directory
+// if needed. The file is replaced atomically, so a failed save keeps the previous aliases.
+func (a *Aliases) Save() error {
+	a.mux.Lock()
+	data, err := json.MarshalIndent(a.keys, "", "\t")
+	a.mux.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(a.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(a.path), filepath.Base(a.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), a.path)
+}
@@ -0,0 +1,63 @@
+package portmidi
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAliasesRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config", "aliases.json")
+	a, err := LoadAliases(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := a.Names(); len(names) != 0 {
+		t.Fatalf("got aliases %v from a missing file", names)
+	}
+	keys := map[string]DeviceKey{
+		"drums": {Interface: "ALSA", Name: "USB Pads", Index: 1},
+		"keys":  {Interface: "CoreMIDI", Name: "Piano#2"},
+		"synth": {Interface: "MMSystem", Name: "Synth"},
+	}
+	for alias, k := range keys {
+		a.Set(alias, k)
+	}
+	a.Delete("synth")
+	delete(keys, "synth")
+	if err := a.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"ALSA:USB Pads#1"`) {
+		t.Errorf("keys are not saved in the text form:\n%s", data)
+	}
+	b, err := LoadAliases(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := b.Names(); !reflect.DeepEqual(names, []string{"drums", "keys"}) {
+		t.Errorf("got aliases %v, want drums and keys", names)
+	}
+	for alias, want := range keys {
+		if k, ok := b.Get(alias); !ok || k != want {
+			t.Errorf("%s: got %v, %v, want %v", alias, k, ok, want)
+		}
+	}
+	if _, ok := b.Get("synth"); ok {
+		t.Error("deleted alias has been saved")
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadAliases(path); err == nil {
+		t.Error("loaded a malformed file")
+	}
+}
@@ -0,0 +1,157 @@
+package portmidi
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// BackpressurePolicy specifies what an input stream does when the consumer falls behind
+// and the Source channel is full.
+type BackpressurePolicy int32
+
+const (
+	// Block stops reading the device until the consumer catches up, the events wait in the
+	// buffer of PortMidi, which overflows when the consumer lags for too long, see Overflows.
+	Block BackpressurePolicy = iota
+	// DropNewest keeps reading the device and drops the received events that do not fit.
+	DropNewest
+	// DropOldest keeps reading the device and drops the oldest events from Source
+	// to make room for the received ones.
+	DropOldest
+	// CoalesceLatest keeps only the latest value of each continuous controller among the events
+	// waiting for room in Source, while keeping all the other events. Pitch bend and channel
+	// pressure are coalesced per channel, poly aftertouch per channel and note, control changes
+	// per channel and controller for the controllers 1-31, 33-63 and 70-95. Bank select (0 and 32)
+	// takes effect on the next program change and data entry (6 and 38) applies to the selected
+	// parameter, so they are kept, as are the switches, e.g. sustain (64-69), the RPN and NRPN
+	// messages (96-101), the channel mode messages (120-127) and all the other messages, e.g.
+	// notes, program changes and SysEx, in order. When the waiting events still fill the buffer
+	// size of the stream, reading blocks like with Block.
+	CoalesceLatest
+)
+
+func (p BackpressurePolicy) String() string {
+	switch p {
+	case Block:
+		return "block"
+	case DropNewest:
+		return "drop newest"
+	case DropOldest:
+		return "drop oldest"
+	case CoalesceLatest:
+		return "coalesce latest"
+	}
+	return fmt.Sprintf("BackpressurePolicy(%d)", int32(p))
+}
+
+// WithBackpressure sets what an input stream does when the consumer falls behind.
+// Input only, the default is Block.
+func WithBackpressure(policy BackpressurePolicy) Option {
+	return func(c *config) error {
+		switch policy {
+		case Block, DropNewest, DropOldest, CoalesceLatest:
+		default:
+			return fmt.Errorf("%w: backpressure policy %d", ErrInvalidOption, policy)
+		}
+		c.backpressure = policy
+		c.inputOnly = append(c.inputOnly, "backpressure")
+		return nil
+	}
+}
+
+// Dropped returns the number of received events dropped under the backpressure policy.
+func (s *InputStream) Dropped() uint64 {
+	return atomic.LoadUint64(&s.stats.dropped)
+}
+
+// blocked reports whether the stream should stop reading the device until
+// the pending events are delivered.
+func (s *InputStream) blocked() bool {
+	switch s.backpressure {
+	case Block:
+		return len(s.pending) > 0
+	case CoalesceLatest:
+		return len(s.pending) >= cap(s.buf)
+	}
+	return false
+}
+
+// relieve applies the backpressure policy to the events that are still pending after a flush.
+func (s *InputStream) relieve() {
+	if len(s.pending) == 0 {
+		return
+	}
+	var dropped int
+	switch s.backpressure {
+	case DropNewest:
+		dropped = len(s.pending)
+		s.pending = s.pending[:0]
+	case DropOldest:
+		for len(s.pending) > 0 {
+			select {
+			case <-s.buf:
+				dropped++
+			default:
+			}
+			s.flush()
+		}
+	case CoalesceLatest:
+		dropped = s.coalesce()
+		s.flush()
+	}
+	if dropped > 0 {
+		atomic.AddUint64(&s.stats.dropped, uint64(dropped))
+	}
+}
+
+// coalesce drops the pending events superseded by a later event for the same controller,
+// keeping the order of the rest, and returns the number of dropped events.
+func (s *InputStream) coalesce() int {
+	s.seen = s.seen[:0]
+	w := len(s.pending)
+	for i := len(s.pending) - 1; i >= 0; i-- {
+		if key, ok := continuousKey(&s.pending[i]); ok {
+			if hasKey(s.seen, key) {
+				continue
+			}
+			s.seen = append(s.seen, key)
+		}
+		w--
+		s.pending[w] = s.pending[i]
+	}
+	s.pending = s.pending[:copy(s.pending, s.pending[w:])]
+	return w
+}
+
+// continuousKey identifies the controller of a continuous message: the status, along with
+// the note for poly aftertouch or the controller number for a control change, see CoalesceLatest.
+func continuousKey(ev *Event) (int32, bool) {
+	if ev.Err != nil || ev.SysExData != nil {
+		return 0, false
+	}
+	switch ev.Message.Status() & 0xF0 {
+	case 0xE0, 0xD0: // pitch bend, channel pressure
+		return int32(ev.Message & 0xFF), true
+	case 0xA0: // poly aftertouch
+		return int32(ev.Message & 0xFFFF), true
+	case 0xB0:
+		switch c := ev.Message.Data1(); {
+		case c == 0 || c == 32: // bank select applies to the next program change
+			return 0, false
+		case c == 6 || c == 38: // data entry applies to the selected parameter
+			return 0, false
+		case c < 64, c >= 70 && c < 96:
+			return int32(ev.Message & 0xFFFF), true
+		}
+	}
+	return 0, false
+}
+
+func hasKey(keys []int32, key int32) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
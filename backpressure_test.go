@@ -0,0 +1,84 @@
+package portmidi
+
+import (
+	"testing"
+)
+
+func TestCoalesce(t *testing.T) {
+	var (
+		volume1     = NewMessage(0xB0, 7, 10)
+		volume2     = NewMessage(0xB0, 7, 20)
+		volume3     = NewMessage(0xB0, 7, 30)
+		otherVolume = NewMessage(0xB1, 7, 40) // channel 1
+		sustainOn   = NewMessage(0xB0, 64, 127)
+		sustainOff  = NewMessage(0xB0, 64, 0)
+		bend1       = NewMessage(0xE0, 0, 0x40)
+		bend2       = NewMessage(0xE0, 0, 0x50)
+		otherBend   = NewMessage(0xE1, 0, 0x60)
+		pressure1   = NewMessage(0xD0, 10, 0)
+		pressure2   = NewMessage(0xD0, 20, 0)
+		touch60a    = NewMessage(0xA0, 60, 10)
+		touch60b    = NewMessage(0xA0, 60, 20)
+		touch62     = NewMessage(0xA0, 62, 30)
+		note        = NewMessage(0x90, 60, 100)
+		rpn         = NewMessage(0xB0, 101, 0)
+		dataEntry1  = NewMessage(0xB0, 6, 2)
+		dataEntry2  = NewMessage(0xB0, 6, 12)
+		bank1       = NewMessage(0xB0, 0, 1)
+		bank2       = NewMessage(0xB0, 0, 2)
+		bankLSB1    = NewMessage(0xB0, 32, 3)
+		bankLSB2    = NewMessage(0xB0, 32, 4)
+		program1    = NewMessage(0xC0, 5, 0)
+		program2    = NewMessage(0xC0, 6, 0)
+	)
+	tests := []struct {
+		name    string
+		pending []Message
+		want    []Message
+	}{
+		{
+			"controllers",
+			[]Message{
+				volume1, sustainOn, volume2, otherVolume, note,
+				sustainOff, rpn, dataEntry1, rpn, dataEntry2, volume3,
+			},
+			[]Message{
+				sustainOn, otherVolume, note,
+				sustainOff, rpn, dataEntry1, rpn, dataEntry2, volume3,
+			},
+		},
+		{
+			"bend and pressure",
+			[]Message{
+				bend1, touch60a, pressure1, otherBend, touch62,
+				note, bend2, touch60b, pressure2,
+			},
+			[]Message{
+				otherBend, touch62, note, bend2, touch60b, pressure2,
+			},
+		},
+		{
+			"bank select",
+			[]Message{bank1, bankLSB1, program1, bank2, bankLSB2, program2},
+			[]Message{bank1, bankLSB1, program1, bank2, bankLSB2, program2},
+		},
+	}
+	for _, tt := range tests {
+		s := &InputStream{}
+		for _, msg := range tt.pending {
+			s.pending = append(s.pending, Event{Message: msg})
+		}
+		if n, want := s.coalesce(), len(tt.pending)-len(tt.want); n != want {
+			t.Errorf("%s: dropped %d events, want %d", tt.name, n, want)
+		}
+		if len(s.pending) != len(tt.want) {
+			t.Errorf("%s: got %d events, want %d", tt.name, len(s.pending), len(tt.want))
+			continue
+		}
+		for i, msg := range tt.want {
+			if s.pending[i].Message != msg {
+				t.Errorf("%s: event %d: got %v, want %v", tt.name, i, s.pending[i].Message, msg)
+			}
+		}
+	}
+}
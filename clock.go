@@ -0,0 +1,79 @@
+package portmidi
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a millisecond time source for stream timestamps.
+type Clock interface {
+	// Now returns the current time in milliseconds.
+	Now() Timestamp
+}
+
+// ClockFunc adapts a function to the Clock interface.
+type ClockFunc func() Timestamp
+
+// Now returns f().
+func (f ClockFunc) Now() Timestamp {
+	return f()
+}
+
+// GoClock is a Clock backed by the Go monotonic clock, it counts milliseconds since its start.
+// Share one GoClock between streams and e.g. an audio engine to get a common time base.
+type GoClock struct {
+	start time.Time
+}
+
+// NewGoClock creates a clock that starts now.
+func NewGoClock() *GoClock {
+	return &GoClock{
+		start: time.Now(),
+	}
+}
+
+// Now returns milliseconds elapsed since the clock start.
+func (c *GoClock) Now() Timestamp {
+	return Timestamp(time.Since(c.start) / time.Millisecond)
+}
+
+// Start returns the time when the clock has started.
+func (c *GoClock) Start() time.Time {
+	return c.start
+}
+
+var (
+	clockMux sync.RWMutex
+	clock    Clock
+)
+
+// SetClock sets the time source of the streams opened afterwards, so the timestamps of input
+// events and scheduled output share the time base with the rest of the application. Passing
+// nil restores the driver's own clock, which is PortTime for the default PortMidi driver.
+func SetClock(c Clock) {
+	clockMux.Lock()
+	clock = c
+	clockMux.Unlock()
+}
+
+func currentClock() Clock {
+	clockMux.RLock()
+	defer clockMux.RUnlock()
+	return clock
+}
+
+// Now returns the current time of the clock used for timestamps, see SetClock.
+func Now() Timestamp {
+	if c := currentClock(); c != nil {
+		return c.Now()
+	}
+	return driver.Time()
+}
+
+// streamClock returns the clock of a stream opened with clock, that is the driver's own clock if it is nil.
+func streamClock(clock Clock) Clock {
+	if clock == nil {
+		return ClockFunc(driver.Time)
+	}
+	return clock
+}
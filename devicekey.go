@@ -0,0 +1,147 @@
+package portmidi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DeviceKey identifies a device by the interface, the name and, for devices that share both,
+// the order among them. Unlike DeviceID, which is the index of the device in the order of
+// enumeration, the key stays valid when other devices are plugged in or removed, so it can
+// be saved in configs. The text form is "Interface:Name" followed by "#Index" when Index > 0,
+// e.g. "ALSA:USB Keys#1" for the second input named USB Keys.
+type DeviceKey struct {
+	Interface string
+	Name      string
+	// Index tells apart devices of the same direction with the same interface and name,
+	// in the order of their IDs.
+	Index int
+}
+
+func (k DeviceKey) String() string {
+	text, _ := k.MarshalText()
+	return string(text)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (k DeviceKey) MarshalText() ([]byte, error) {
+	if strings.Contains(k.Interface, ":") {
+		return nil, fmt.Errorf("portmidi: interface name %q contains a colon", k.Interface)
+	}
+	text := k.Interface + ":" + k.Name
+	if k.Index > 0 || hasIndexSuffix(k.Name) {
+		text += "#" + strconv.Itoa(k.Index)
+	}
+	return []byte(text), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (k *DeviceKey) UnmarshalText(text []byte) error {
+	s := string(text)
+	i := strings.Index(s, ":")
+	if i < 0 {
+		return fmt.Errorf("portmidi: invalid device key %q: missing interface", s)
+	}
+	key := DeviceKey{
+		Interface: s[:i],
+		Name:      s[i+1:],
+	}
+	if hasIndexSuffix(key.Name) {
+		j := strings.LastIndex(key.Name, "#")
+		index, err := strconv.Atoi(key.Name[j+1:])
+		if err != nil {
+			return fmt.Errorf("portmidi: invalid device key %q: %v", s, err)
+		}
+		key.Name, key.Index = key.Name[:j], index
+	}
+	*k = key
+	return nil
+}
+
+// ParseDeviceKey parses the text form of a device key, see DeviceKey.
+func ParseDeviceKey(s string) (DeviceKey, error) {
+	var k DeviceKey
+	err := k.UnmarshalText([]byte(s))
+	return k, err
+}
+
+// hasIndexSuffix reports whether s ends with "#" and digits.
+func hasIndexSuffix(s string) bool {
+	j := strings.LastIndex(s, "#")
+	if j < 0 || j == len(s)-1 {
+		return false
+	}
+	for _, r := range s[j+1:] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// KeyOf returns the key of the device with the given ID.
+func KeyOf(id DeviceID) (DeviceKey, error) {
+	lib.mux.Lock()
+	defer lib.mux.Unlock()
+	if lib.refs == 0 {
+		return DeviceKey{}, ErrNotInitialized
+	}
+	return findKey(id)
+}
+
+// findKey returns the key of the device, the library must be initialized.
+func findKey(id DeviceID) (DeviceKey, error) {
+	for _, d := range listDevices(nil) {
+		if d.ID == id {
+			return d.Key, nil
+		}
+	}
+	return DeviceKey{}, ErrDeviceNotFound
+}
+
+// ResolveInput returns the current ID of the input device with the key,
+// or ErrDeviceNotFound if the device is not present.
+func (k DeviceKey) ResolveInput() (DeviceID, error) {
+	lib.mux.Lock()
+	defer lib.mux.Unlock()
+	if lib.refs == 0 {
+		return 0, ErrNotInitialized
+	}
+	return k.resolve(true)
+}
+
+// ResolveOutput returns the current ID of the output device with the key,
+// or ErrDeviceNotFound if the device is not present.
+func (k DeviceKey) ResolveOutput() (DeviceID, error) {
+	lib.mux.Lock()
+	defer lib.mux.Unlock()
+	if lib.refs == 0 {
+		return 0, ErrNotInitialized
+	}
+	return k.resolve(false)
+}
+
+// resolve returns the current ID of the device, the library must be initialized.
+func (k DeviceKey) resolve(input bool) (DeviceID, error) {
+	for _, d := range directionDevices(input) {
+		if d.Key == k {
+			return d.ID, nil
+		}
+	}
+	return 0, ErrDeviceNotFound
+}
+
+func directionDevices(input bool) []Device {
+	if input {
+		return listDevices(isInput)
+	}
+	return listDevices(isOutput)
+}
+
+// keyOf returns the key of the device, or the zero key if the device is not present.
+// The library must be initialized.
+func keyOf(id DeviceID) DeviceKey {
+	k, _ := findKey(id)
+	return k
+}
@@ -0,0 +1,96 @@
+package portmidi
+
+import (
+	"testing"
+)
+
+func TestDeviceKeyText(t *testing.T) {
+	tests := []struct {
+		key  DeviceKey
+		text string
+	}{
+		{DeviceKey{Interface: "ALSA", Name: "USB Keys"}, "ALSA:USB Keys"},
+		{DeviceKey{Interface: "ALSA", Name: "USB Keys", Index: 1}, "ALSA:USB Keys#1"},
+		{DeviceKey{Interface: "CoreMIDI", Name: "Bus: 1"}, "CoreMIDI:Bus: 1"},
+		{DeviceKey{Interface: "Virtual", Name: "Pad#2"}, "Virtual:Pad#2#0"},
+		{DeviceKey{Interface: "Virtual", Name: "Pad#2", Index: 3}, "Virtual:Pad#2#3"},
+		{DeviceKey{Interface: "Virtual", Name: "Pad#"}, "Virtual:Pad#"},
+		{DeviceKey{Interface: "Virtual", Name: "Pad#A"}, "Virtual:Pad#A"},
+		{DeviceKey{Interface: "MMSystem"}, "MMSystem:"},
+	}
+	for _, tt := range tests {
+		text, err := tt.key.MarshalText()
+		if err != nil {
+			t.Errorf("%#v: %v", tt.key, err)
+			continue
+		}
+		if string(text) != tt.text {
+			t.Errorf("%#v: got %q, want %q", tt.key, text, tt.text)
+		}
+		key, err := ParseDeviceKey(tt.text)
+		if err != nil {
+			t.Errorf("%q: %v", tt.text, err)
+			continue
+		}
+		if key != tt.key {
+			t.Errorf("%q: got %#v, want %#v", tt.text, key, tt.key)
+		}
+	}
+
+	if _, err := (DeviceKey{Interface: "A:B", Name: "Keys"}).MarshalText(); err == nil {
+		t.Error("marshaled an interface with a colon")
+	}
+	for _, s := range []string{"", "USB Keys", "ALSA:Keys#99999999999999999999"} {
+		if k, err := ParseDeviceKey(s); err == nil {
+			t.Errorf("%q: got %#v, want an error", s, k)
+		}
+	}
+	var k DeviceKey
+	if err := k.UnmarshalText([]byte("ALSA:USB Keys#2")); err != nil || k != (DeviceKey{"ALSA", "USB Keys", 2}) {
+		t.Errorf("got %#v, %v", k, err)
+	}
+}
+
+func TestResolveDuplicates(t *testing.T) {
+	drv := useVirtualDriver(t)
+	first := drv.AddInput("Keys")
+	drv.AddOutput("Keys")
+	second := drv.AddInput("Keys")
+
+	tests := []struct {
+		key  DeviceKey
+		want DeviceID
+	}{
+		{DeviceKey{Interface: VirtualInterface, Name: "Keys"}, first},
+		{DeviceKey{Interface: VirtualInterface, Name: "Keys", Index: 1}, second},
+	}
+	for _, tt := range tests {
+		id, err := tt.key.ResolveInput()
+		if err != nil || id != tt.want {
+			t.Errorf("%v: got %d, %v, want %d", tt.key, id, err, tt.want)
+		}
+		if k, err := KeyOf(tt.want); err != nil || k != tt.key {
+			t.Errorf("key of %d: got %v, %v, want %v", tt.want, k, err, tt.key)
+		}
+	}
+	if id, err := (DeviceKey{Interface: VirtualInterface, Name: "Keys"}).ResolveOutput(); err != nil || id != 1 {
+		t.Errorf("output: got %d, %v, want 1", id, err)
+	}
+	for _, k := range []DeviceKey{
+		{Interface: VirtualInterface, Name: "Keys", Index: 2},
+		{Interface: "ALSA", Name: "Keys"},
+	} {
+		if _, err := k.ResolveInput(); err != ErrDeviceNotFound {
+			t.Errorf("%v: got %v, want ErrDeviceNotFound", k, err)
+		}
+	}
+	if _, err := (DeviceKey{Interface: VirtualInterface, Name: "Keys", Index: 1}).ResolveOutput(); err != ErrDeviceNotFound {
+		t.Errorf("second output: got %v, want ErrDeviceNotFound", err)
+	}
+
+	// once the first input is gone, the second one is the only input named Keys
+	drv.Remove(first)
+	if id, err := (DeviceKey{Interface: VirtualInterface, Name: "Keys"}).ResolveInput(); err != nil || id != second-1 {
+		t.Errorf("after removal: got %d, %v, want %d", id, err, second-1)
+	}
+}
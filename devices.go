@@ -0,0 +1,171 @@
+package portmidi
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Device describes a MIDI device along with its ID.
+type Device struct {
+	ID DeviceID
+	// Key identifies the device regardless of its ID, see DeviceKey.
+	Key DeviceKey
+	DeviceInfo
+}
+
+func (d Device) String() string {
+	return fmt.Sprintf("%d: %s (%s)", d.ID, d.Name, d.Interface)
+}
+
+// Devices returns all the devices known to the driver, none if the library is not initialized.
+func Devices() []Device {
+	return queryDevices(nil)
+}
+
+// Inputs returns the devices available for the input.
+func Inputs() []Device {
+	return queryDevices(isInput)
+}
+
+// Outputs returns the devices available for the output.
+func Outputs() []Device {
+	return queryDevices(isOutput)
+}
+
+func isInput(d *Device) bool  { return d.IsInputAvailable }
+func isOutput(d *Device) bool { return d.IsOutputAvailable }
+
+// queryDevices lists the devices unless the library is not initialized, it holds lib.mux
+// so the library is not terminated meanwhile.
+func queryDevices(filter func(d *Device) bool) []Device {
+	lib.mux.Lock()
+	defer lib.mux.Unlock()
+	if lib.refs == 0 {
+		return nil
+	}
+	return listDevices(filter)
+}
+
+// listDevices lists the devices, the library must be initialized.
+func listDevices(filter func(d *Device) bool) []Device {
+	n := driver.CountDevices()
+	devices := make([]Device, 0, n)
+	type group struct {
+		key   DeviceKey
+		input bool
+	}
+	duplicates := make(map[group]int)
+	for i := 0; i < n; i++ {
+		info := driver.DeviceInfo(DeviceID(i))
+		if info == nil {
+			continue
+		}
+		g := group{
+			key:   DeviceKey{Interface: info.Interface, Name: info.Name},
+			input: info.IsInputAvailable,
+		}
+		d := Device{
+			ID:         DeviceID(i),
+			Key:        g.key,
+			DeviceInfo: *info,
+		}
+		d.Key.Index = duplicates[g]
+		duplicates[g]++
+		if filter == nil || filter(&d) {
+			devices = append(devices, d)
+		}
+	}
+	return devices
+}
+
+// Matcher selects devices in FindInput and FindOutput.
+type Matcher func(d *Device) bool
+
+// ByName matches devices with exactly the given name.
+func ByName(name string) Matcher {
+	return func(d *Device) bool {
+		return d.Name == name
+	}
+}
+
+// ByNameContains matches devices whose name contains s, ignoring case.
+func ByNameContains(s string) Matcher {
+	s = strings.ToLower(s)
+	return func(d *Device) bool {
+		return strings.Contains(strings.ToLower(d.Name), s)
+	}
+}
+
+// ByNamePattern matches devices whose name matches the regular expression.
+func ByNamePattern(re *regexp.Regexp) Matcher {
+	return func(d *Device) bool {
+		return re.MatchString(d.Name)
+	}
+}
+
+// ByInterface matches devices of the MIDI API with the given name, ignoring case,
+// e.g. ALSA, CoreMIDI or MMSystem.
+func ByInterface(name string) Matcher {
+	return func(d *Device) bool {
+		return strings.EqualFold(d.Interface, name)
+	}
+}
+
+// ErrDeviceNotFound is returned by FindInput and FindOutput when no device matches.
+var ErrDeviceNotFound = errors.New("portmidi: device not found")
+
+// AmbiguousDeviceError is returned by FindInput and FindOutput when more than one device matches.
+type AmbiguousDeviceError struct {
+	Devices []Device
+}
+
+func (e *AmbiguousDeviceError) Error() string {
+	names := make([]string, len(e.Devices))
+	for i, d := range e.Devices {
+		names[i] = d.String() + " key " + d.Key.String()
+	}
+	return fmt.Sprintf("portmidi: %d devices match: %s", len(e.Devices), strings.Join(names, ", "))
+}
+
+// FindInput returns the only input device that satisfies all the matchers, e.g.
+//
+//	dev, err := portmidi.FindInput(portmidi.ByInterface("ALSA"), portmidi.ByNameContains("usb"))
+//
+// It returns ErrDeviceNotFound if no device matches or *AmbiguousDeviceError if several do.
+func FindInput(matchers ...Matcher) (Device, error) {
+	return findDevice(Inputs(), matchers)
+}
+
+// FindOutput returns the only output device that satisfies all the matchers, see FindInput.
+func FindOutput(matchers ...Matcher) (Device, error) {
+	return findDevice(Outputs(), matchers)
+}
+
+func findDevice(devices []Device, matchers []Matcher) (Device, error) {
+	var found []Device
+	for i := range devices {
+		if matchAll(&devices[i], matchers) {
+			found = append(found, devices[i])
+		}
+	}
+	switch len(found) {
+	case 0:
+		return Device{}, ErrDeviceNotFound
+	case 1:
+		return found[0], nil
+	}
+	return Device{}, &AmbiguousDeviceError{
+		Devices: found,
+	}
+}
+
+func matchAll(d *Device, matchers []Matcher) bool {
+	for _, match := range matchers {
+		if !match(d) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package portmidi
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+)
+
+// addDevices declares the devices of the discovery tests: two inputs with the same name,
+// a name shared by a virtual and an ALSA input, and an output.
+func addDevices(drv *VirtualDriver) {
+	drv.AddInput("USB Keyboard")
+	drv.AddInput("USB Keyboard")
+	drv.AddInput("Launchpad Mini")
+	drv.addDevice(DeviceInfo{
+		Interface:        "ALSA",
+		Name:             "Launchpad Mini",
+		IsInputAvailable: true,
+	})
+	drv.AddOutput("Synth")
+}
+
+func TestDevices(t *testing.T) {
+	drv := useVirtualDriver(t)
+	addDevices(drv)
+
+	devices := Devices()
+	if len(devices) != 5 {
+		t.Fatalf("got %d devices, want 5", len(devices))
+	}
+	for i, d := range devices {
+		if d.ID != DeviceID(i) {
+			t.Errorf("device %d: got ID %d", i, d.ID)
+		}
+	}
+	if k := devices[1].Key; k != (DeviceKey{Interface: VirtualInterface, Name: "USB Keyboard", Index: 1}) {
+		t.Errorf("got key %v for the second USB Keyboard", k)
+	}
+	if n := len(Inputs()); n != 4 {
+		t.Errorf("got %d inputs, want 4", n)
+	}
+	if outputs := Outputs(); len(outputs) != 1 || outputs[0].Name != "Synth" {
+		t.Errorf("got outputs %v, want Synth", outputs)
+	}
+
+	in, err := OpenInput(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	if !Devices()[2].IsOpened {
+		t.Error("device of an open stream is not reported as opened")
+	}
+}
+
+func TestFindDevice(t *testing.T) {
+	drv := useVirtualDriver(t)
+	addDevices(drv)
+
+	tests := []struct {
+		name     string
+		matchers []Matcher
+		want     DeviceID
+	}{
+		{"exact", []Matcher{ByName("Launchpad Mini"), ByInterface(VirtualInterface)}, 2},
+		{"substring", []Matcher{ByNameContains("launchpad"), ByInterface("alsa")}, 3},
+		{"pattern", []Matcher{ByNamePattern(regexp.MustCompile(`^Launch\w+ M`)), ByInterface("ALSA")}, 3},
+		{"interface", []Matcher{ByInterface("ALSA")}, 3},
+	}
+	for _, tt := range tests {
+		d, err := FindInput(tt.matchers...)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if d.ID != tt.want {
+			t.Errorf("%s: got device %v, want ID %d", tt.name, d, tt.want)
+		}
+	}
+
+	if d, err := FindOutput(ByNameContains("SYN")); err != nil || d.ID != 4 {
+		t.Errorf("output: got %v, %v, want Synth", d, err)
+	}
+	if _, err := FindInput(ByName("Synth")); err != ErrDeviceNotFound {
+		t.Errorf("output device as an input: got %v, want ErrDeviceNotFound", err)
+	}
+	if _, err := FindInput(ByName("usb keyboard")); err != ErrDeviceNotFound {
+		t.Errorf("exact name in another case: got %v, want ErrDeviceNotFound", err)
+	}
+
+	for _, matchers := range [][]Matcher{
+		{ByName("USB Keyboard")},
+		{ByNameContains("launchpad")},
+	} {
+		_, err := FindInput(matchers...)
+		var ambiguous *AmbiguousDeviceError
+		if !errors.As(err, &ambiguous) {
+			t.Errorf("got %v, want *AmbiguousDeviceError", err)
+			continue
+		}
+		if len(ambiguous.Devices) != 2 {
+			t.Errorf("got %d ambiguous devices, want 2", len(ambiguous.Devices))
+		}
+	}
+}
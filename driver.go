@@ -0,0 +1,83 @@
+package portmidi
+
+import "unsafe"
+
+// Driver is a MIDI backend behind the package-level functions and streams.
+// The default driver calls into PortMidi through the pm package, see SetDriver
+// to replace it, e.g. with a VirtualDriver in tests.
+type Driver interface {
+	// Initialize prepares the driver for use, see portmidi.Initialize.
+	Initialize() error
+	// Terminate releases the driver resources, see portmidi.Terminate.
+	Terminate() error
+	// CountDevices gets devices count, ids range from 0 to CountDevices()-1.
+	CountDevices() int
+	// DeviceInfo returns device info for the provided device ID, or nil if ID is out of range.
+	DeviceInfo(id DeviceID) *DeviceInfo
+	// DefaultInputDeviceID returns the default input device ID or ok=false if there are no devices.
+	DefaultInputDeviceID() (DeviceID, bool)
+	// DefaultOutputDeviceID returns the default output device ID or ok=false if there are no devices.
+	DefaultOutputDeviceID() (DeviceID, bool)
+	// HostErrorText returns the last host error message, if any.
+	HostErrorText() string
+	// Time returns the current time of the driver's own clock in milliseconds.
+	Time() Timestamp
+	// OpenInput opens device for the input, Latency of the config is not used.
+	OpenInput(id DeviceID, config StreamConfig) (DriverStream, error)
+	// OpenOutput opens device for the output.
+	OpenOutput(id DeviceID, config StreamConfig) (DriverStream, error)
+}
+
+// StreamConfig holds the settings a Driver opens a stream with.
+type StreamConfig struct {
+	// BufferSize is a number of events to be buffered.
+	BufferSize int
+	// Latency is the output latency in milliseconds.
+	Latency int
+	// Clock timestamps input events and output timestamps are relative to it,
+	// nil means the driver's own clock.
+	Clock Clock
+	// DriverInfo is passed as is to the underlying API, see WithDriverInfo.
+	DriverInfo unsafe.Pointer
+}
+
+// DriverStream is an open device handle returned by a Driver. Its methods are not
+// required to be safe for concurrent use, streams serialize access to it.
+type DriverStream interface {
+	// Poll reports whether input is available.
+	Poll() (bool, error)
+	// Read reads up to len(buf) raw events, SysEx data arrives packed
+	// by 4 bytes per Message, the same way PortMidi delivers it.
+	Read(buf []Event) (int, error)
+	// Write writes raw events, SysEx messages are packed by 4 bytes per Message.
+	Write(buf []Event) error
+	// WriteShort writes a timestamped non-system-exclusive MIDI message.
+	WriteShort(timestamp Timestamp, msg Message) error
+	// WriteSysEx writes a timestamped system-exclusive MIDI message including F0 and F7,
+	// a message that is not framed by them fails with pm.ErrBadData. The data is not retained.
+	WriteSysEx(timestamp Timestamp, data []byte) error
+	// SetFilter sets filters on an input stream to drop selected input types.
+	SetFilter(filters Filter) error
+	// SetChannelMask filters incoming messages based on channel.
+	SetChannelMask(mask ChannelMask) error
+	// HasHostError tests whether stream has a pending host error.
+	HasHostError() bool
+	// Abort terminates outgoing messages immediately.
+	Abort() error
+	// Synchronize resynchronizes an output stream to its time source.
+	Synchronize() error
+	// Close closes the stream.
+	Close() error
+}
+
+var driver Driver = pmDriver{}
+
+// SetDriver replaces the driver used by the package, passing nil restores the
+// default PortMidi driver. It must be called before Initialize and must not be
+// called while any streams are open.
+func SetDriver(d Driver) {
+	if d == nil {
+		d = pmDriver{}
+	}
+	driver = d
+}
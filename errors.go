@@ -0,0 +1,71 @@
+package portmidi
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/xlab/portmidi/pm"
+)
+
+// Error describes a failed operation on a device. It unwraps to the underlying error,
+// so errors.Is works against the pm.Err* sentinels, e.g. pm.ErrHostError.
+type Error struct {
+	// Op is the failed operation, e.g. "open", "read" or "write".
+	Op         string
+	DeviceID   DeviceID
+	DeviceName string
+	// Code is the PortMidi error code, it is zero (pm.NoError) for errors that do not
+	// come from PortMidi, e.g. ErrDeviceRemoved.
+	Code pm.Error
+	// HostError is the host error text taken at the time of failure, if Code is pm.HostError.
+	HostError string
+	Err       error
+}
+
+func (e *Error) Error() string {
+	msg := strings.TrimPrefix(e.Err.Error(), "portmidi: ")
+	if len(e.HostError) > 0 {
+		msg += ": " + e.HostError
+	}
+	return fmt.Sprintf("portmidi: %s device %d (%s): %s", e.Op, e.DeviceID, e.DeviceName, msg)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// newError wraps an error returned by the driver, nil stays nil. The errors that are already
+// wrapped, as well as ErrClosed and ErrAborted, are returned as is.
+func newError(op string, id DeviceID, name string, err error) error {
+	var e *Error
+	if err == nil || err == ErrClosed || err == ErrAborted || errors.As(err, &e) {
+		return err
+	}
+	e = &Error{
+		Op:         op,
+		DeviceID:   id,
+		DeviceName: name,
+		Err:        err,
+	}
+	if code := pm.ErrorCode(err); code != pm.InternalError || errors.Is(err, pm.ErrInternalError) {
+		e.Code = code
+	}
+	if e.Code == pm.HostError {
+		e.HostError = driver.HostErrorText()
+	}
+	return e
+}
+
+// wrap wraps an error returned by the driver stream, s.mux must be held.
+func (s *baseStream) wrap(op string, err error) error {
+	return newError(op, s.id, s.key.Name, err)
+}
+
+// hostError returns the pending host error of the stream, if any, s.mux must be held.
+func (s *baseStream) hostError(op string) error {
+	if s.stream == nil || !s.stream.HasHostError() {
+		return nil
+	}
+	return s.wrap(op, pm.ErrHostError)
+}
@@ -0,0 +1,53 @@
+package portmidi
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/xlab/portmidi/pm"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code pm.Error
+	}{
+		{pm.ErrBadData, pm.BadData},
+		{pm.ErrBufferOverflow, pm.BufferOverflow},
+		{pm.ErrInternalError, pm.InternalError},
+		{ErrDeviceRemoved, pm.NoError},
+		{errors.New("other"), pm.NoError},
+	}
+	for _, tt := range tests {
+		var e *Error
+		if !errors.As(newError("write", 1, "Out", tt.err), &e) {
+			t.Fatalf("%v: not wrapped", tt.err)
+		}
+		if e.Code != tt.code {
+			t.Errorf("%v: got code %d, want %d", tt.err, e.Code, tt.code)
+		}
+		if !errors.Is(e, tt.err) {
+			t.Errorf("%v: does not unwrap to the cause", tt.err)
+		}
+	}
+}
+
+func TestErrorHostError(t *testing.T) {
+	drv := useVirtualDriver(t)
+	outID, _ := drv.AddLoopback("Loop")
+	out, err := OpenOutput(outID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	drv.Remove(outID)
+	err = out.Write(context.Background(), Event{Message: NewMessage(0x90, 60, 100)})
+	var e *Error
+	if !errors.As(err, &e) || !errors.Is(err, pm.ErrHostError) {
+		t.Fatalf("got %v, want a host error", err)
+	}
+	if e.Code != pm.HostError || e.HostError == "" {
+		t.Errorf("got code %d and host error %q, want the host error text", e.Code, e.HostError)
+	}
+}
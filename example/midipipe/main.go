@@ -3,19 +3,22 @@ package main
 import (
 	"flag"
 	"log"
+	"strings"
 	"time"
 
-	"github.com/rcrowley/go-metrics"
 	"github.com/xlab/closer"
 	"github.com/xlab/portmidi"
 	"github.com/xlab/treeprint"
 )
 
 var (
-	inName   = flag.String("in", "", "MIDI device name to use as input.")
-	outName  = flag.String("out", "", "MIDI device name to use as output.")
-	inDevID  = flag.Int("in-dev", -1, "MIDI device ID to use as input.")
-	outDevID = flag.Int("out-dev", -1, "MIDI device ID to use as output.")
+	inName      = flag.String("in", "", "MIDI device alias, key (e.g. \"ALSA:USB Keys#1\") or name to use as input.")
+	outName     = flag.String("out", "", "MIDI device alias, key or name to use as output.")
+	inDevID     = flag.Int("in-dev", -1, "MIDI device ID to use as input.")
+	outDevID    = flag.Int("out-dev", -1, "MIDI device ID to use as output.")
+	aliasesPath = flag.String("aliases", "", "Path to the device aliases file, defaults to the user config dir.")
+	saveIn      = flag.String("save-in", "", "Save the input device under this alias.")
+	saveOut     = flag.String("save-out", "", "Save the output device under this alias.")
 )
 
 func init() {
@@ -26,9 +29,13 @@ func init() {
 func main() {
 	defer closer.Close()
 
-	portmidi.Initialize()
+	session, err := portmidi.NewSession()
+	if err != nil {
+		closer.Fatalln("[ERR] cannot initialize portmidi:", err)
+	}
 	closer.Bind(func() {
-		portmidi.Terminate()
+		// closes the streams that are still open
+		session.Close()
 	})
 
 	numDevices := portmidi.CountDevices()
@@ -36,25 +43,17 @@ func main() {
 	if numDevices < 2 {
 		closer.Fatalln("[ERR] midipipe cannot operate with less than 2 devices")
 	}
-	inputs := make(map[string]portmidi.DeviceID, numDevices)
-	outputs := make(map[string]portmidi.DeviceID, numDevices)
-	for i := 0; i < numDevices; i++ {
-		info := portmidi.GetDeviceInfo(portmidi.DeviceID(i))
-		if info.IsInputAvailable {
-			inputs[info.Name] = portmidi.DeviceID(i)
-		}
-		if info.IsOutputAvailable {
-			outputs[info.Name] = portmidi.DeviceID(i)
-		}
-	}
-	log.Println("[INFO] available inputs:", inputs)
-	log.Println("[INFO] available outputs:", outputs)
-	inDev := findCandidate(inputs, *inDevID, *inName, true)
-	outDev := findCandidate(outputs, *outDevID, *outName, false)
+	log.Println("[INFO] available inputs:", portmidi.Inputs())
+	log.Println("[INFO] available outputs:", portmidi.Outputs())
+	aliases := loadAliases()
+	inDev := findCandidate(aliases, *inDevID, *inName, true)
+	outDev := findCandidate(aliases, *outDevID, *outName, false)
+	saveAlias(aliases, *saveIn, inDev)
+	saveAlias(aliases, *saveOut, outDev)
 
 	inInfo := portmidi.GetDeviceInfo(inDev)
 	log.Printf("[INFO] input device id=%d %s", inDev, treeprint.Repr(inInfo))
-	in, err := portmidi.NewInputStream(inDev, 1024, 0)
+	in, err := session.OpenInput(inDev, portmidi.WithBufferSize(1024))
 	if err != nil {
 		closer.Fatalln("[ERR] cannot init an input stream:", err)
 	}
@@ -63,7 +62,7 @@ func main() {
 	})
 	outInfo := portmidi.GetDeviceInfo(outDev)
 	log.Printf("[INFO] output device id=%d %s", outDev, treeprint.Repr(outInfo))
-	out, err := portmidi.NewOutputStream(outDev, 1024, 0, 0)
+	out, err := session.OpenOutput(outDev, portmidi.WithBufferSize(1024))
 	if err != nil {
 		closer.Fatalln("[ERR] cannot init an output stream:", err)
 	}
@@ -72,27 +71,60 @@ func main() {
 		log.Println("bye!")
 	})
 
-	meter := metrics.NewMeter()
 	go func() {
 		t := time.NewTicker(time.Minute)
 		for range t.C {
-			snap := meter.Snapshot()
-			log.Println("[DBG] rate 1 minute", snap.Rate1())
-			log.Println("[DBG] rate 5 minute", snap.Rate5())
-			log.Println("[DBG] rate mean", snap.RateMean())
+			inStats, outStats := in.Stats(), out.Stats()
+			log.Printf("[DBG] in: %d events, %d dropped, %d overflows, delay %v..%v",
+				inStats.Events, inStats.Dropped, inStats.Overflows, inStats.Delay.Min, inStats.Delay.Max)
+			log.Printf("[DBG] out: %d events, %d write errors, queue %d",
+				outStats.Events, outStats.WriteErrors, outStats.QueueDepth)
 		}
 	}()
 	go func() {
 		sink := out.Sink()
 		for ev := range in.Source() {
-			meter.Mark(int64(1))
+			if ev.Err != nil {
+				log.Println("[WARN] input error:", ev.Err)
+				continue
+			}
 			sink <- ev
 		}
 	}()
 	closer.Hold()
 }
 
-func findCandidate(devices map[string]portmidi.DeviceID,
+func loadAliases() *portmidi.Aliases {
+	path := *aliasesPath
+	if len(path) == 0 {
+		var err error
+		if path, err = portmidi.DefaultAliasesPath(); err != nil {
+			closer.Fatalln("[ERR] cannot locate the aliases file:", err)
+		}
+	}
+	aliases, err := portmidi.LoadAliases(path)
+	if err != nil {
+		closer.Fatalln("[ERR] cannot load the aliases:", err)
+	}
+	return aliases
+}
+
+func saveAlias(aliases *portmidi.Aliases, alias string, dev portmidi.DeviceID) {
+	if len(alias) == 0 {
+		return
+	}
+	key, err := portmidi.KeyOf(dev)
+	if err != nil {
+		closer.Fatalln("[ERR] cannot save alias", alias, err)
+	}
+	aliases.Set(alias, key)
+	if err := aliases.Save(); err != nil {
+		closer.Fatalln("[ERR] cannot save alias", alias, err)
+	}
+	log.Printf("[INFO] saved alias %s for %s", alias, key)
+}
+
+func findCandidate(aliases *portmidi.Aliases,
 	id int, name string, input bool) (dev portmidi.DeviceID) {
 
 	if id >= 0 {
@@ -100,12 +132,37 @@ func findCandidate(devices map[string]portmidi.DeviceID,
 		return
 	}
 	if len(name) > 0 {
-		nameID, ok := devices[name]
+		key, ok := aliases.Get(name)
+		if !ok && strings.Contains(name, ":") {
+			var err error
+			key, err = portmidi.ParseDeviceKey(name)
+			ok = err == nil
+		}
 		if ok {
-			dev = nameID
+			var err error
+			if input {
+				dev, err = key.ResolveInput()
+			} else {
+				dev, err = key.ResolveOutput()
+			}
+			if err != nil {
+				closer.Fatalln("[ERR] midipipe was unable to locate required device:", key, err)
+			}
 			return
 		}
-		closer.Fatalln("[ERR] midipipe was unable to locate required device:", name)
+		find := portmidi.FindOutput
+		if input {
+			find = portmidi.FindInput
+		}
+		d, err := find(portmidi.ByName(name))
+		if err == portmidi.ErrDeviceNotFound {
+			d, err = find(portmidi.ByNameContains(name))
+		}
+		if err != nil {
+			closer.Fatalln("[ERR] midipipe was unable to locate required device:", name, err)
+		}
+		dev = d.ID
+		return
 	}
 	if input {
 		dev, _ = portmidi.DefaultInputDeviceID()
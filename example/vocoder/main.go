@@ -5,7 +5,6 @@ import (
 	"log"
 
 	"github.com/xlab/closer"
-	"github.com/xlab/midievent"
 	"github.com/xlab/portmidi"
 )
 
@@ -33,19 +32,27 @@ func main() {
 	if numDevices < 1 {
 		closer.Fatalln("[ERR] vocoder cannot operate with less than one MIDI device")
 	}
-	inputs := make(map[string]portmidi.DeviceID, numDevices)
-	for i := 0; i < numDevices; i++ {
-		info := portmidi.GetDeviceInfo(portmidi.DeviceID(i))
-		if info.IsInputAvailable {
-			inputs[info.Name] = portmidi.DeviceID(i)
-		}
-	}
-	log.Println("[INFO] available inputs:", inputs)
-	devID := findCandidate(inputs, *inDevID, *inName, true)
+	log.Println("[INFO] available inputs:", portmidi.Inputs())
+	devID := findInput(*inDevID, *inName)
 	info := portmidi.GetDeviceInfo(devID)
 	log.Printf("Using %s (via %s)", info.Name, info.Interface)
-	midiIn, err := portmidi.NewInputStream(devID, 512, 0,
-		portmidi.FilterControl|portmidi.FilterAftertouch|portmidi.FilterSystemCommon|portmidi.FilterRealtime)
+	vocoder := NewVocoder()
+	// the handler switches notes right on the input goroutine, without a channel hop
+	midiIn, err := portmidi.OpenInput(devID,
+		portmidi.WithBufferSize(512),
+		portmidi.WithFilter(portmidi.FilterControl|portmidi.FilterAftertouch|
+			portmidi.FilterSystemCommon|portmidi.FilterRealtime),
+		portmidi.WithEventHandler(func(ev portmidi.Event) {
+			msg, err := portmidi.Decode(ev.Message)
+			if err != nil {
+				return
+			}
+			if on, ok := msg.(portmidi.NoteOn); ok {
+				n := int(on.Key)
+				log.Printf("note %d (%.3fHz)", n, noteToFreq(n))
+				vocoder.SwitchNote(n)
+			}
+		}))
 	if err != nil {
 		closer.Fatalln(err)
 	}
@@ -53,18 +60,6 @@ func main() {
 		midiIn.Close()
 	})
 
-	vocoder := NewVocoder()
-	go func() {
-		for ev := range midiIn.Source() {
-			msg := portmidi.Message(ev.Message)
-			if midievent.IsNoteOn(midievent.Event(msg.Status())) {
-				n := int(msg.Data1())
-				log.Printf("note %d (%.3fHz)", n, noteToFreq(n))
-				vocoder.SwitchNote(n)
-			}
-		}
-	}()
-
 	in := make(chan []float32, 64)
 	out := make(chan []float32, 64)
 	go func() {
@@ -94,25 +89,22 @@ func main() {
 	closer.Hold()
 }
 
-func findCandidate(devices map[string]portmidi.DeviceID,
-	id int, name string, input bool) (dev portmidi.DeviceID) {
-
+func findInput(id int, name string) (dev portmidi.DeviceID) {
 	if id >= 0 {
 		dev = portmidi.DeviceID(id)
 		return
 	}
 	if len(name) > 0 {
-		nameID, ok := devices[name]
-		if ok {
-			dev = nameID
-			return
+		d, err := portmidi.FindInput(portmidi.ByName(name))
+		if err == portmidi.ErrDeviceNotFound {
+			d, err = portmidi.FindInput(portmidi.ByNameContains(name))
 		}
-		closer.Fatalln("[ERR] vocoder was unable to locate required device:", name)
-	}
-	if input {
-		dev, _ = portmidi.DefaultInputDeviceID()
+		if err != nil {
+			closer.Fatalln("[ERR] vocoder was unable to locate required device:", name, err)
+		}
+		dev = d.ID
 		return
 	}
-	dev, _ = portmidi.DefaultOutputDeviceID()
+	dev, _ = portmidi.DefaultInputDeviceID()
 	return
 }
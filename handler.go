@@ -0,0 +1,86 @@
+package portmidi
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// WithEventHandler makes an input stream call handler for each received event instead of
+// delivering the events to Source. Without workers, see WithHandlerWorkers, the handler runs
+// on the input reader goroutine shared by all input streams, right after the events are
+// read, so there is no channel hop. It must return quickly, as it delays the input of all
+// streams. It may open and close other streams, but it must not call Close of its own
+// stream. The last events of a closed stream, e.g. a truncated SysEx message, are handled
+// on the goroutine calling Close.
+// A panic in the handler is recovered and counted, see HandlerPanics. Input only.
+func WithEventHandler(handler func(Event)) Option {
+	return func(c *config) error {
+		if handler == nil {
+			return fmt.Errorf("%w: nil event handler", ErrInvalidOption)
+		}
+		c.handler = handler
+		c.inputOnly = append(c.inputOnly, "event handler")
+		return nil
+	}
+}
+
+// WithHandlerWorkers runs the event handler on a pool of workers goroutines, for handlers
+// that do heavier work. Events are queued in the buffer of the stream and the backpressure
+// policy applies when the queue is full, see WithBufferSize and WithBackpressure. With more
+// than one worker, events may be handled out of order. Close waits for the workers to handle
+// the queued events. Requires WithEventHandler, input only.
+func WithHandlerWorkers(workers int) Option {
+	return func(c *config) error {
+		if workers <= 0 {
+			return fmt.Errorf("%w: %d handler workers", ErrInvalidOption, workers)
+		}
+		c.workers = workers
+		c.inputOnly = append(c.inputOnly, "handler workers")
+		return nil
+	}
+}
+
+// HandlerPanics returns the number of panics recovered from the event handler.
+func (s *InputStream) HandlerPanics() uint64 {
+	return atomic.LoadUint64(&s.panics)
+}
+
+// startWorkers runs the handler workers that consume s.buf.
+func (s *InputStream) startWorkers(n int) {
+	s.workersDone.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer s.workersDone.Done()
+			for ev := range s.buf {
+				s.handle(ev)
+			}
+		}()
+	}
+}
+
+// dispatch handles the events read for the handler, the reader calls it without holding
+// its mux, so the handler may open and close other streams.
+func (s *InputStream) dispatch() {
+	s.hmux.Lock()
+	defer s.hmux.Unlock()
+	s.handlePending()
+}
+
+// handlePending handles the events read for the handler, s.hmux must be held.
+func (s *InputStream) handlePending() {
+	for i := range s.handling {
+		s.handle(s.handling[i])
+		s.handling[i] = Event{}
+	}
+	s.handling = s.handling[:0]
+}
+
+// handle calls the handler recovering from a panic.
+func (s *InputStream) handle(ev Event) {
+	defer func() {
+		if recover() != nil {
+			atomic.AddUint64(&s.panics, 1)
+		}
+	}()
+	s.handler(ev)
+}
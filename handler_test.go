@@ -0,0 +1,84 @@
+package portmidi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHandlerOpensAndClosesStreams(t *testing.T) {
+	drv := useVirtualDriver(t)
+	aID := drv.AddInput("A")
+	bID := drv.AddInput("B")
+	cID := drv.AddInput("C")
+	b, err := OpenInput(bID, WithEventHandler(func(Event) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type result struct {
+		c        *InputStream
+		openErr  error
+		closeErr error
+	}
+	done := make(chan result, 1)
+	a, err := OpenInput(aID, WithEventHandler(func(ev Event) {
+		var r result
+		r.closeErr = b.Close()
+		r.c, r.openErr = OpenInput(cID)
+		done <- r
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	drv.Send(bID, Event{Message: NewMessage(0x90, 60, 100)})
+	drv.Send(aID, Event{Message: NewMessage(0x90, 60, 100)})
+	select {
+	case r := <-done:
+		if r.closeErr != nil {
+			t.Errorf("close from the handler: %v", r.closeErr)
+		}
+		if r.openErr != nil {
+			t.Fatalf("open from the handler: %v", r.openErr)
+		}
+		r.c.Close()
+	case <-time.After(time.Second):
+		t.Fatal("the handler has not returned")
+	}
+	if err := b.Close(); err != ErrClosed {
+		t.Errorf("second close: got %v, want ErrClosed", err)
+	}
+}
+
+func TestHandlerLastEvents(t *testing.T) {
+	drv := useVirtualDriver(t)
+	inID := drv.AddInput("In")
+	events := make(chan Event, 8)
+	in, err := OpenInput(inID, WithEventHandler(func(ev Event) { events <- ev }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := NewMessage(0xF8, 0, 0)
+	drv.Send(inID,
+		Event{Message: Message(0x030201F0)}, // SysEx without the end
+		Event{Message: clock},
+	)
+	select {
+	case ev := <-events:
+		if ev.Message != clock {
+			t.Fatalf("got %v, want clock", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event handled")
+	}
+	if err := in.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-events:
+		if ev.Err != ErrSysExTruncated {
+			t.Errorf("got %v, want the truncated SysEx", ev)
+		}
+	default:
+		t.Error("the truncated SysEx has not been handled by Close")
+	}
+}
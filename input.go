@@ -0,0 +1,387 @@
+package portmidi
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xlab/portmidi/pm"
+)
+
+// InputStream is a stream opened for the input, received events are read from Source.
+type InputStream struct {
+	// panics comes first to be aligned for the atomic operations on 32-bit platforms.
+	panics uint64
+	baseStream
+	buf   chan Event
+	sysEx sysExAssembler
+	// pending events wait for room in buf, rbuf is the read buffer.
+	pending  []Event
+	rbuf     []Event
+	notifies bool
+	// readErr is the cause of the last reported read error.
+	readErr error
+
+	backpressure BackpressurePolicy
+	// seen is the scratch list of controllers for coalesce.
+	seen []int32
+
+	// handler is called for received events, by workers if there are any.
+	handler     func(Event)
+	workers     int
+	workersDone sync.WaitGroup
+	// handling holds the events read for the handler without workers, they are handled
+	// by the reader after it releases its mux, see dispatch. hmux is held while handling.
+	handling []Event
+	hmux     sync.Mutex
+
+	// filters and mask are the current settings, guarded by mux.
+	filters Filter
+	mask    ChannelMask
+	// reattached is set by attach, so poll drops the SysEx message pending
+	// from the previous driver stream, guarded by mux.
+	reattached bool
+}
+
+// allChannels is the channel mask that passes all channels.
+const allChannels ChannelMask = 0xFFFF
+
+// readBufferSize is the number of raw events read from the driver at once.
+const readBufferSize = 128
+
+var _ Stream = (*InputStream)(nil)
+
+// NewInputStream opens device for the input. The buffersize specifies the number of input events to be
+// buffered waiting to be read. It is a shorthand for OpenInput with the corresponding options.
+func NewInputStream(id DeviceID, bufferSize int,
+	channels ChannelMask, filters ...Filter) (*InputStream, error) {
+
+	var opts []Option
+	if bufferSize > 0 {
+		opts = append(opts, WithBufferSize(bufferSize))
+	}
+	if channels > 0 { // all allowed by default
+		opts = append(opts, WithChannelMask(channels))
+	}
+	if len(filters) > 0 {
+		opts = append(opts, WithFilter(filters...))
+	}
+	return OpenInput(id, opts...)
+}
+
+// OpenInput opens device for the input with the given options,
+// options that apply only to the output are rejected with ErrInvalidOption.
+func OpenInput(id DeviceID, opts ...Option) (*InputStream, error) {
+	c, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.validate(true); err != nil {
+		return nil, err
+	}
+	lib.mux.Lock()
+	defer lib.mux.Unlock()
+	if lib.refs == 0 {
+		return nil, ErrNotInitialized
+	}
+	openStreams.mux.Lock()
+	defer openStreams.mux.Unlock()
+	stream, err := driver.OpenInput(id, c.streamConfig())
+	if err != nil {
+		return nil, newError("open", id, keyOf(id).Name, err)
+	}
+	s := &InputStream{
+		baseStream: baseStream{
+			stream: stream,
+			id:     id,
+			key:    keyOf(id),
+			config: c.streamConfig(),
+			clock:  streamClock(c.clock),
+			stats:  newCounters(),
+		},
+		buf:     make(chan Event, c.bufferSize),
+		rbuf:    make([]Event, readBufferSize),
+		sysEx:   sysExAssembler{limit: c.sysExLimit},
+		filters: FilterActive, // PortMidi default
+		mask:    allChannels,
+
+		backpressure: c.backpressure,
+		handler:      c.handler,
+		workers:      c.workers,
+	}
+	if c.mask != 0 {
+		s.mask = c.mask
+	}
+	if c.hasFilters {
+		s.filters = c.filters
+	}
+	if err := s.attach(stream); err != nil {
+		stream.Close()
+		return nil, s.wrap("open", err)
+	}
+	track(s)
+	if s.workers > 0 {
+		s.startWorkers(s.workers)
+	}
+	reader.add(s)
+	return s, nil
+}
+
+func (s *InputStream) base() *baseStream {
+	return &s.baseStream
+}
+
+func (s *InputStream) isInput() bool {
+	return true
+}
+
+// attach applies the settings of the stream to a newly opened driver stream.
+func (s *InputStream) attach(stream DriverStream) error {
+	if s.mask != allChannels {
+		if err := stream.SetChannelMask(s.mask); err != nil {
+			return err
+		}
+	}
+	if s.filters != FilterActive {
+		if err := stream.SetFilter(s.filters); err != nil {
+			return err
+		}
+	}
+	if n, ok := stream.(notifier); ok && s.notifies {
+		n.setNotify(reader.wake)
+	}
+	s.reattached = true
+	return nil
+}
+
+// Close closes a midi stream, the events that are still pending are dropped.
+// The handler workers, if any, finish the queued events first. Subsequent calls return ErrClosed.
+func (s *InputStream) Close() error {
+	if !s.beginClose() {
+		return ErrClosed
+	}
+	reader.remove(s)
+	s.hmux.Lock()
+	s.pending = s.sysEx.flush(s.pending, ErrSysExTruncated)
+	s.flush()
+	s.handlePending()
+	s.hmux.Unlock()
+	close(s.buf)
+	s.workersDone.Wait()
+	err := s.closeStream()
+	untrack(s)
+	if s.session != nil {
+		s.session.forget(s)
+	}
+	return err
+}
+
+// SetFilter replaces the filters of the stream, it is safe to call while the stream is being read.
+// By default, only active sensing messages are filtered.
+func (s *InputStream) SetFilter(filters Filter) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.stream == nil {
+		return ErrClosed
+	}
+	if err := s.stream.SetFilter(filters); err != nil {
+		return s.wrap("set filter", err)
+	}
+	s.filters = filters
+	return nil
+}
+
+// Filter returns the current filters of the stream.
+func (s *InputStream) Filter() Filter {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.filters
+}
+
+// SetChannelMask replaces the channel mask of the stream, it is safe to call while the stream
+// is being read. Mask 0 restores the default that allows all channels.
+func (s *InputStream) SetChannelMask(mask ChannelMask) error {
+	if mask == 0 {
+		mask = allChannels
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.stream == nil {
+		return ErrClosed
+	}
+	if err := s.stream.SetChannelMask(mask); err != nil {
+		return s.wrap("set channel mask", err)
+	}
+	s.mask = mask
+	return nil
+}
+
+// ChannelMask returns the current channel mask of the stream.
+func (s *InputStream) ChannelMask() ChannelMask {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.mask
+}
+
+// Source returns a channel of received events, it is closed when the stream is closed.
+// Events with Err set report an error rather than a message, check Err before forwarding
+// an event to an output.
+// Nothing is delivered to Source when the stream has an event handler, see WithEventHandler.
+func (s *InputStream) Source() <-chan Event {
+	return s.buf
+}
+
+// Read blocks until at least one event is received or ctx is done, then fills buf with
+// the events available without blocking and returns their number. It reads from the same
+// queue as Source, so each event is delivered either by Read or by Source.
+// Read returns io.EOF once the stream is closed and all events have been read.
+func (s *InputStream) Read(ctx context.Context, buf []Event) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case ev, ok := <-s.buf:
+		if !ok {
+			return 0, io.EOF
+		}
+		buf[0] = ev
+	}
+	n := 1
+	for n < len(buf) {
+		select {
+		case ev, ok := <-s.buf:
+			if !ok {
+				return n, nil
+			}
+			buf[n] = ev
+			n++
+		default:
+			return n, nil
+		}
+	}
+	return n, nil
+}
+
+// poll delivers the pending events and reads new ones from the driver unless the backlog
+// blocks reading under the backpressure policy. Like Pm_Poll, Poll of the driver reports the
+// host errors of the input, so an idle poll is a single driver call, the stream is checked
+// for a pending host error only after a read. It reports whether any events were moved and
+// whether some are left pending.
+func (s *InputStream) poll() (progress, pending bool) {
+	if len(s.pending) > 0 {
+		progress = s.flush() > 0
+		if s.blocked() {
+			return progress, true
+		}
+	}
+	var n int
+	var hostErr error
+	s.mux.Lock()
+	if s.reattached {
+		s.reattached = false
+		s.sysEx.discard()
+	}
+	ok, err := s.stream.Poll()
+	if ok {
+		n, err = s.stream.Read(s.rbuf)
+	}
+	if err != nil {
+		err = s.wrap("read", err)
+	} else if ok {
+		hostErr = s.hostError("read")
+	}
+	s.mux.Unlock()
+	if err != nil {
+		if s.readError(err) {
+			s.flush()
+			s.relieve()
+			progress = true
+		}
+		return progress, len(s.pending) > 0
+	}
+	s.readErr = nil
+	if n <= 0 && hostErr == nil {
+		return progress, len(s.pending) > 0
+	}
+	start := len(s.pending)
+	for i := range s.rbuf[:n] {
+		s.pending = s.sysEx.feed(s.pending, s.rbuf[i])
+	}
+	if len(s.pending) > start {
+		now, arrival := s.clock.Now(), time.Now()
+		for i := range s.pending[start:] {
+			ev := &s.pending[start+i]
+			ev.Arrival = arrival
+			s.stats.count(ev)
+			s.stats.delay(now, ev.Timestamp)
+		}
+	}
+	if hostErr != nil {
+		s.readError(hostErr)
+	}
+	s.flush()
+	s.relieve()
+	return true, len(s.pending) > 0
+}
+
+// readError reports the error as an event. On input buffer overflow PortMidi flushes its buffer,
+// so a partially received SysEx message is discarded, each overflow is reported. Other errors
+// are reported once until the input recovers. It reports whether an event has been added.
+func (s *InputStream) readError(err error) bool {
+	cause := err
+	if e, ok := err.(*Error); ok {
+		cause = e.Err
+	}
+	if cause == pm.ErrBufferOverflow {
+		atomic.AddUint64(&s.stats.overflows, 1)
+		s.sysEx.discard()
+	} else if cause == s.readErr {
+		return false
+	}
+	s.readErr = cause
+	s.pending = append(s.pending, Event{
+		Err: err,
+	})
+	return true
+}
+
+// Overflows returns the number of times the input buffer has overflowed, losing events.
+func (s *InputStream) Overflows() uint64 {
+	return atomic.LoadUint64(&s.stats.overflows)
+}
+
+// Stats returns the statistics of the stream. Events and SysExBytes count the received
+// events, QueueDepth is the number of events waiting in Source.
+func (s *InputStream) Stats() Stats {
+	return s.stats.snapshot(len(s.buf))
+}
+
+// flush sends the pending events without blocking and returns the number of events sent.
+// With an event handler and no workers, it hands all the pending events to the handler.
+func (s *InputStream) flush() int {
+	if s.handler != nil && s.workers == 0 {
+		n := len(s.pending)
+		s.handling = append(s.handling, s.pending...)
+		for i := range s.pending {
+			s.pending[i] = Event{}
+		}
+		s.pending = s.pending[:0]
+		return n
+	}
+	var n int
+loop:
+	for n < len(s.pending) {
+		select {
+		case s.buf <- s.pending[n]:
+			n++
+		default:
+			break loop
+		}
+	}
+	s.pending = s.pending[:copy(s.pending, s.pending[n:])]
+	return n
+}
@@ -0,0 +1,57 @@
+package portmidi
+
+import (
+	"testing"
+)
+
+func TestSetFilterAndChannelMask(t *testing.T) {
+	drv := useVirtualDriver(t)
+	inID := drv.AddInput("In")
+	in, err := OpenInput(inID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := in.Filter(); f != FilterActive {
+		t.Errorf("got filter %#x, want FilterActive", f)
+	}
+	if m := in.ChannelMask(); m != allChannels {
+		t.Errorf("got channel mask %#x, want all channels", m)
+	}
+	clock := NewMessage(0xF8, 0, 0)
+	drv.Send(inID, Event{Message: clock})
+	if ev := receive(t, in); ev.Message != clock {
+		t.Fatalf("got %v, want clock", ev)
+	}
+
+	if err := in.SetFilter(FilterClock | FilterActive); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.SetChannelMask(Channel(2)); err != nil {
+		t.Fatal(err)
+	}
+	if f := in.Filter(); f != FilterClock|FilterActive {
+		t.Errorf("got filter %#x, want clock and active sensing", f)
+	}
+	if m := in.ChannelMask(); m != Channel(2) {
+		t.Errorf("got channel mask %#x, want channel 2", m)
+	}
+	noteOn2 := NewMessage(0x92, 60, 100)
+	drv.Send(inID,
+		Event{Message: clock},                     // filtered
+		Event{Message: NewMessage(0x90, 60, 100)}, // channel 0, masked
+		Event{Message: noteOn2},
+	)
+	if ev := receive(t, in); ev.Message != noteOn2 {
+		t.Errorf("got %v, want the note on channel 2", ev)
+	}
+
+	if err := in.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.SetFilter(FilterNote); err != ErrClosed {
+		t.Errorf("set filter after close: got %v, want ErrClosed", err)
+	}
+	if err := in.SetChannelMask(Channel(0)); err != ErrClosed {
+		t.Errorf("set channel mask after close: got %v, want ErrClosed", err)
+	}
+}
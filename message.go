@@ -0,0 +1,297 @@
+package portmidi
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidMessage is returned by Decode for a message with an invalid status or data byte,
+// and by Encode for a typed message with a field out of its range.
+var ErrInvalidMessage = errors.New("portmidi: invalid message")
+
+// The typed messages convert to Message with their Message method and back with Decode.
+// Channels are 0-15 and data values are 0-127. Message masks the fields to their range and
+// clamps the 14-bit values, e.g. NoteOn{Key: 200} is sent as key 72, use Encode to reject
+// such messages instead.
+
+// NoteOff is a note-off message (0x8n). Decode also returns a note-on message with
+// zero velocity as NoteOff with zero velocity, as the MIDI specification treats them alike.
+type NoteOff struct {
+	Channel  uint8
+	Key      uint8
+	Velocity uint8
+}
+
+func (m NoteOff) Message() Message {
+	return channelMessage(0x80, m.Channel, m.Key, m.Velocity)
+}
+
+// NoteOn is a note-on message (0x9n), with Velocity 0 it encodes a note-off, see NoteOff.
+type NoteOn struct {
+	Channel  uint8
+	Key      uint8
+	Velocity uint8
+}
+
+func (m NoteOn) Message() Message {
+	return channelMessage(0x90, m.Channel, m.Key, m.Velocity)
+}
+
+// PolyAftertouch is a polyphonic key pressure message (0xAn).
+type PolyAftertouch struct {
+	Channel  uint8
+	Key      uint8
+	Pressure uint8
+}
+
+func (m PolyAftertouch) Message() Message {
+	return channelMessage(0xA0, m.Channel, m.Key, m.Pressure)
+}
+
+// ControlChange is a control change message (0xBn), including the channel mode messages.
+type ControlChange struct {
+	Channel    uint8
+	Controller uint8
+	Value      uint8
+}
+
+func (m ControlChange) Message() Message {
+	return channelMessage(0xB0, m.Channel, m.Controller, m.Value)
+}
+
+// ProgramChange is a program change message (0xCn).
+type ProgramChange struct {
+	Channel uint8
+	Program uint8
+}
+
+func (m ProgramChange) Message() Message {
+	return channelMessage(0xC0, m.Channel, m.Program, 0)
+}
+
+// ChannelPressure is a channel pressure message (0xDn).
+type ChannelPressure struct {
+	Channel  uint8
+	Pressure uint8
+}
+
+func (m ChannelPressure) Message() Message {
+	return channelMessage(0xD0, m.Channel, m.Pressure, 0)
+}
+
+// PitchBend is a pitch bend message (0xEn).
+type PitchBend struct {
+	Channel uint8
+	// Value is the bend from -8192 to 8191, 0 is the center, Message clamps it to the range.
+	Value int16
+}
+
+func (m PitchBend) Message() Message {
+	lsb, msb := split14(int(m.Value) + 8192)
+	return channelMessage(0xE0, m.Channel, lsb, msb)
+}
+
+// TimeCode is a MIDI time code quarter frame message (0xF1).
+type TimeCode struct {
+	// Piece is the index of the quarter frame from 0 to 7.
+	Piece uint8
+	// Value is the 4-bit value of the piece.
+	Value uint8
+}
+
+func (m TimeCode) Message() Message {
+	return NewMessage(0xF1, (m.Piece&0x07)<<4|m.Value&0x0F, 0)
+}
+
+// SongPosition is a song position pointer message (0xF2).
+type SongPosition struct {
+	// Beats is the number of MIDI beats, sixteenth notes, from the start of the song, up to 16383.
+	Beats uint16
+}
+
+func (m SongPosition) Message() Message {
+	lsb, msb := split14(int(m.Beats))
+	return NewMessage(0xF2, lsb, msb)
+}
+
+// SongSelect is a song select message (0xF3).
+type SongSelect struct {
+	Song uint8
+}
+
+func (m SongSelect) Message() Message {
+	return NewMessage(0xF3, m.Song&0x7F, 0)
+}
+
+// TuneRequest is a tune request message (0xF6).
+type TuneRequest struct{}
+
+func (TuneRequest) Message() Message { return NewMessage(0xF6, 0, 0) }
+
+// The system real-time messages.
+type (
+	// TimingClock is sent 24 times per quarter note (0xF8).
+	TimingClock struct{}
+	// Start starts the sequence (0xFA).
+	Start struct{}
+	// Continue resumes the sequence (0xFB).
+	Continue struct{}
+	// Stop stops the sequence (0xFC).
+	Stop struct{}
+	// ActiveSensing is sent to keep the connection alive (0xFE).
+	ActiveSensing struct{}
+	// SystemReset resets the receivers (0xFF).
+	SystemReset struct{}
+)
+
+func (TimingClock) Message() Message   { return NewMessage(0xF8, 0, 0) }
+func (Start) Message() Message         { return NewMessage(0xFA, 0, 0) }
+func (Continue) Message() Message      { return NewMessage(0xFB, 0, 0) }
+func (Stop) Message() Message          { return NewMessage(0xFC, 0, 0) }
+func (ActiveSensing) Message() Message { return NewMessage(0xFE, 0, 0) }
+func (SystemReset) Message() Message   { return NewMessage(0xFF, 0, 0) }
+
+// Decode converts a short message to its typed value, e.g. NoteOn or TimingClock. A status
+// byte below 0x80, an undefined status, a SysEx status or a data byte above 0x7F used by
+// the message are rejected with ErrInvalidMessage, the unused data bytes are ignored.
+func Decode(msg Message) (interface{}, error) {
+	status, data1, data2 := msg.Status(), msg.Data1(), msg.Data2()
+	if status < 0x80 {
+		return nil, fmt.Errorf("%w: status %#04x", ErrInvalidMessage, status)
+	}
+	n := dataLength(status)
+	if n < 0 {
+		return nil, fmt.Errorf("%w: status %#04x", ErrInvalidMessage, status)
+	}
+	if n > 0 && data1 > 0x7F || n > 1 && data2 > 0x7F {
+		return nil, fmt.Errorf("%w: status %#04x with data %#04x %#04x", ErrInvalidMessage, status, data1, data2)
+	}
+	ch := status & 0x0F
+	switch status & 0xF0 {
+	case 0x80:
+		return NoteOff{Channel: ch, Key: data1, Velocity: data2}, nil
+	case 0x90:
+		if data2 == 0 {
+			return NoteOff{Channel: ch, Key: data1}, nil
+		}
+		return NoteOn{Channel: ch, Key: data1, Velocity: data2}, nil
+	case 0xA0:
+		return PolyAftertouch{Channel: ch, Key: data1, Pressure: data2}, nil
+	case 0xB0:
+		return ControlChange{Channel: ch, Controller: data1, Value: data2}, nil
+	case 0xC0:
+		return ProgramChange{Channel: ch, Program: data1}, nil
+	case 0xD0:
+		return ChannelPressure{Channel: ch, Pressure: data1}, nil
+	case 0xE0:
+		return PitchBend{Channel: ch, Value: int16(join14(data1, data2) - 8192)}, nil
+	}
+	switch status {
+	case 0xF1:
+		return TimeCode{Piece: data1 >> 4, Value: data1 & 0x0F}, nil
+	case 0xF2:
+		return SongPosition{Beats: uint16(join14(data1, data2))}, nil
+	case 0xF3:
+		return SongSelect{Song: data1}, nil
+	case 0xF6:
+		return TuneRequest{}, nil
+	case 0xF8:
+		return TimingClock{}, nil
+	case 0xFA:
+		return Start{}, nil
+	case 0xFB:
+		return Continue{}, nil
+	case 0xFC:
+		return Stop{}, nil
+	case 0xFE:
+		return ActiveSensing{}, nil
+	case 0xFF:
+		return SystemReset{}, nil
+	}
+	return nil, fmt.Errorf("%w: status %#04x", ErrInvalidMessage, status)
+}
+
+// Encode converts a typed message, e.g. NoteOn, to Message like its Message method, but a field
+// out of its range is rejected with ErrInvalidMessage instead of being masked or clamped.
+func Encode(v interface{}) (Message, error) {
+	var valid bool
+	switch m := v.(type) {
+	case NoteOff:
+		valid = m.Channel <= 0x0F && data7(m.Key, m.Velocity)
+	case NoteOn:
+		valid = m.Channel <= 0x0F && data7(m.Key, m.Velocity)
+	case PolyAftertouch:
+		valid = m.Channel <= 0x0F && data7(m.Key, m.Pressure)
+	case ControlChange:
+		valid = m.Channel <= 0x0F && data7(m.Controller, m.Value)
+	case ProgramChange:
+		valid = m.Channel <= 0x0F && data7(m.Program)
+	case ChannelPressure:
+		valid = m.Channel <= 0x0F && data7(m.Pressure)
+	case PitchBend:
+		valid = m.Channel <= 0x0F && m.Value >= -8192 && m.Value <= 8191
+	case TimeCode:
+		valid = m.Piece <= 0x07 && m.Value <= 0x0F
+	case SongPosition:
+		valid = m.Beats <= 0x3FFF
+	case SongSelect:
+		valid = data7(m.Song)
+	case TuneRequest, TimingClock, Start, Continue, Stop, ActiveSensing, SystemReset:
+		valid = true
+	default:
+		return 0, fmt.Errorf("%w: %T is not a typed message", ErrInvalidMessage, v)
+	}
+	if !valid {
+		return 0, fmt.Errorf("%w: %T%+v out of range", ErrInvalidMessage, v, v)
+	}
+	return v.(interface{ Message() Message }).Message(), nil
+}
+
+// data7 reports whether the values fit in 7-bit data bytes.
+func data7(values ...uint8) bool {
+	for _, v := range values {
+		if v > 0x7F {
+			return false
+		}
+	}
+	return true
+}
+
+// dataLength returns the number of data bytes of a short message with status,
+// or -1 if the status does not start a short message.
+func dataLength(status byte) int {
+	switch status & 0xF0 {
+	case 0x80, 0x90, 0xA0, 0xB0, 0xE0:
+		return 2
+	case 0xC0, 0xD0:
+		return 1
+	}
+	switch status {
+	case 0xF2:
+		return 2
+	case 0xF1, 0xF3:
+		return 1
+	case 0xF6, 0xF8, 0xFA, 0xFB, 0xFC, 0xFE, 0xFF:
+		return 0
+	}
+	return -1
+}
+
+func channelMessage(status, channel, data1, data2 uint8) Message {
+	return NewMessage(status|channel&0x0F, data1&0x7F, data2&0x7F)
+}
+
+// split14 splits a 14-bit value into the least and the most significant 7 bits,
+// clamping it to the range.
+func split14(v int) (lsb, msb uint8) {
+	if v < 0 {
+		v = 0
+	} else if v > 0x3FFF {
+		v = 0x3FFF
+	}
+	return uint8(v & 0x7F), uint8(v >> 7)
+}
+
+func join14(lsb, msb uint8) int {
+	return int(msb)<<7 | int(lsb)
+}
@@ -0,0 +1,89 @@
+package portmidi
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	for _, v := range []interface{}{
+		NoteOff{Channel: 15, Key: 127, Velocity: 64},
+		NoteOn{Channel: 9, Key: 36, Velocity: 127},
+		PolyAftertouch{Channel: 1, Key: 60, Pressure: 10},
+		ControlChange{Channel: 0, Controller: 64, Value: 127},
+		ProgramChange{Channel: 2, Program: 127},
+		ChannelPressure{Channel: 3, Pressure: 0},
+		PitchBend{Channel: 4, Value: -8192},
+		PitchBend{Channel: 4, Value: 0},
+		PitchBend{Channel: 4, Value: 8191},
+		TimeCode{Piece: 7, Value: 15},
+		SongPosition{Beats: 16383},
+		SongSelect{Song: 127},
+		TuneRequest{},
+		TimingClock{},
+		Start{},
+		Continue{},
+		Stop{},
+		ActiveSensing{},
+		SystemReset{},
+	} {
+		msg, err := Encode(v)
+		if err != nil {
+			t.Errorf("%#v: %v", v, err)
+			continue
+		}
+		if want := v.(interface{ Message() Message }).Message(); msg != want {
+			t.Errorf("%#v: Encode gives %#x, Message gives %#x", v, msg, want)
+		}
+		got, err := Decode(msg)
+		if err != nil {
+			t.Errorf("%#v: %v", v, err)
+			continue
+		}
+		if got != v {
+			t.Errorf("got %#v, want %#v", got, v)
+		}
+	}
+}
+
+func TestMessageOutOfRange(t *testing.T) {
+	tests := []struct {
+		v    interface{ Message() Message }
+		want Message
+	}{
+		{NoteOn{Key: 200, Velocity: 100}, NewMessage(0x90, 72, 100)},
+		{NoteOff{Channel: 17, Key: 60}, NewMessage(0x81, 60, 0)},
+		{ControlChange{Controller: 7, Value: 128}, NewMessage(0xB0, 7, 0)},
+		{PitchBend{Value: 9000}, NewMessage(0xE0, 0x7F, 0x7F)},
+		{PitchBend{Value: -9000}, NewMessage(0xE0, 0, 0)},
+		{SongPosition{Beats: 20000}, NewMessage(0xF2, 0x7F, 0x7F)},
+		{TimeCode{Piece: 8, Value: 1}, NewMessage(0xF1, 0x01, 0)},
+	}
+	for _, tt := range tests {
+		if got := tt.v.Message(); got != tt.want {
+			t.Errorf("%#v: got %#x, want %#x", tt.v, got, tt.want)
+		}
+		if _, err := Encode(tt.v); !errors.Is(err, ErrInvalidMessage) {
+			t.Errorf("%#v: got %v, want ErrInvalidMessage", tt.v, err)
+		}
+	}
+	if _, err := Encode(NewMessage(0x90, 60, 100)); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("encoding a Message: got %v, want ErrInvalidMessage", err)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for _, msg := range []Message{
+		NewMessage(0x40, 0, 0),    // running status
+		NewMessage(0x90, 0x80, 1), // data byte above 0x7F
+		NewMessage(0xF0, 1, 2),    // SysEx
+		NewMessage(0xF4, 0, 0),    // undefined
+	} {
+		if _, err := Decode(msg); !errors.Is(err, ErrInvalidMessage) {
+			t.Errorf("%#x: got %v, want ErrInvalidMessage", msg, err)
+		}
+	}
+	if v, err := Decode(NewMessage(0x90, 60, 0)); err != nil || v != (NoteOff{Key: 60}) {
+		t.Errorf("note-on with zero velocity: got %#v, %v, want NoteOff", v, err)
+	}
+}
@@ -0,0 +1,238 @@
+package portmidi
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unsafe"
+
+	"github.com/xlab/portmidi/pm"
+)
+
+// DefaultBufferSize is the number of events buffered by streams opened without WithBufferSize.
+const DefaultBufferSize = 1024
+
+// ErrInvalidOption is returned by Open when an option is invalid or does not apply
+// to the direction of the stream, e.g. a filter on an output.
+var ErrInvalidOption = errors.New("portmidi: invalid option")
+
+// Option configures a stream opened with Open, OpenInput or OpenOutput.
+type Option func(c *config) error
+
+// config holds the settings of a stream being opened.
+type config struct {
+	bufferSize int
+	latency    int
+	mask       ChannelMask
+	filters    Filter
+	hasFilters bool
+	clock      Clock
+	driverInfo unsafe.Pointer
+	sysExLimit int
+
+	backpressure BackpressurePolicy
+	handler      func(Event)
+	workers      int
+
+	policy       ErrorPolicy
+	batchSize    int
+	batchLatency time.Duration
+	scheduler    bool
+	tolerance    time.Duration
+	chunkSize    int
+	chunkPause   time.Duration
+
+	// inputOnly and outputOnly are the names of the options set that apply to one direction.
+	inputOnly  []string
+	outputOnly []string
+}
+
+func newConfig(opts []Option) (*config, error) {
+	c := &config{
+		bufferSize: DefaultBufferSize,
+		batchSize:  DefaultBatchSize,
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	if c.clock == nil {
+		c.clock = currentClock()
+	}
+	return c, nil
+}
+
+func (c *config) validate(input bool) error {
+	if input && len(c.outputOnly) > 0 {
+		return fmt.Errorf("%w: %s on an input stream", ErrInvalidOption, c.outputOnly[0])
+	}
+	if !input && len(c.inputOnly) > 0 {
+		return fmt.Errorf("%w: %s on an output stream", ErrInvalidOption, c.inputOnly[0])
+	}
+	if c.workers > 0 && c.handler == nil {
+		return fmt.Errorf("%w: handler workers without an event handler", ErrInvalidOption)
+	}
+	return nil
+}
+
+func (c *config) streamConfig() StreamConfig {
+	sc := StreamConfig{
+		BufferSize: c.bufferSize,
+		Latency:    c.latency,
+		Clock:      c.clock,
+		DriverInfo: c.driverInfo,
+	}
+	if c.scheduler {
+		// the scheduler applies the latency, the driver sends immediately
+		sc.Latency = 0
+	}
+	return sc
+}
+
+// WithBufferSize sets the number of events to be buffered by the stream, both by PortMidi
+// and by the Source or Sink channel. The default is DefaultBufferSize.
+func WithBufferSize(size int) Option {
+	return func(c *config) error {
+		if size <= 0 {
+			return fmt.Errorf("%w: buffer size %d", ErrInvalidOption, size)
+		}
+		c.bufferSize = size
+		return nil
+	}
+}
+
+// WithLatency sets the output latency in milliseconds, see NewOutputStream.
+// Output only, latency < 0 is treated as 0.
+func WithLatency(latency int) Option {
+	return func(c *config) error {
+		if latency < 0 {
+			latency = 0
+		}
+		c.latency = latency
+		c.outputOnly = append(c.outputOnly, "latency")
+		return nil
+	}
+}
+
+// WithChannelMask sets the channels received by an input stream, see Channel.
+// Input only, by default all channels are received.
+func WithChannelMask(mask ChannelMask) Option {
+	return func(c *config) error {
+		if mask == 0 {
+			return fmt.Errorf("%w: empty channel mask", ErrInvalidOption)
+		}
+		c.mask = mask
+		c.inputOnly = append(c.inputOnly, "channel mask")
+		return nil
+	}
+}
+
+// WithFilter sets the filters of an input stream to drop selected input types.
+// Input only, by default only active sensing messages are filtered.
+func WithFilter(filters ...Filter) Option {
+	return func(c *config) error {
+		c.filters.Join(filters...)
+		c.hasFilters = true
+		c.inputOnly = append(c.inputOnly, "filter")
+		return nil
+	}
+}
+
+// WithClock sets the time source of the stream, it overrides the clock set by SetClock.
+func WithClock(clock Clock) Option {
+	return func(c *config) error {
+		if clock == nil {
+			return fmt.Errorf("%w: nil clock", ErrInvalidOption)
+		}
+		c.clock = clock
+		return nil
+	}
+}
+
+// WithDriverInfo passes a pointer to the driver specific info structure to PortMidi,
+// it is ignored by the API that does not use it.
+func WithDriverInfo(info unsafe.Pointer) Option {
+	return func(c *config) error {
+		c.driverInfo = info
+		return nil
+	}
+}
+
+// WithSysExBufferSize limits the size of received SysEx messages in bytes including F0 and F7,
+// longer messages are reported with ErrSysExTruncated and the rest of them is dropped.
+// Input only, by default the size is not limited.
+func WithSysExBufferSize(size int) Option {
+	return func(c *config) error {
+		if size < 2 {
+			return fmt.Errorf("%w: sysex buffer size %d", ErrInvalidOption, size)
+		}
+		c.sysExLimit = size
+		c.inputOnly = append(c.inputOnly, "sysex buffer size")
+		return nil
+	}
+}
+
+// WithSysExChunks splits the SysEx messages longer than size bytes written to an output into
+// chunks of size bytes and waits for pause between them, for slow hardware that cannot take
+// a large dump at once. The other writes wait during the pauses, while Abort cuts the message
+// short. Size must be a multiple of 4, as PortMidi carries SysEx data in 4-byte messages.
+// Output only, by default SysEx messages are sent whole.
+func WithSysExChunks(size int, pause time.Duration) Option {
+	return func(c *config) error {
+		if size <= 0 || size%4 != 0 || pause < 0 {
+			return fmt.Errorf("%w: sysex chunks of %d bytes with %v pause", ErrInvalidOption, size, pause)
+		}
+		c.chunkSize = size
+		c.chunkPause = pause
+		c.outputOnly = append(c.outputOnly, "sysex chunks")
+		return nil
+	}
+}
+
+// WithErrorPolicy sets how failed writes are handled, see SetErrorPolicy. Output only.
+func WithErrorPolicy(policy ErrorPolicy) Option {
+	return func(c *config) error {
+		switch policy {
+		case ContinueOnError, StopOnError:
+		default:
+			return fmt.Errorf("%w: error policy %d", ErrInvalidOption, policy)
+		}
+		c.policy = policy
+		c.outputOnly = append(c.outputOnly, "error policy")
+		return nil
+	}
+}
+
+// WithBatching configures aggregation of the events written into Sink, see SetBatching. Output only.
+func WithBatching(size int, latency time.Duration) Option {
+	return func(c *config) error {
+		if size <= 0 {
+			size = DefaultBatchSize
+		}
+		if latency < 0 {
+			return fmt.Errorf("%w: batch latency %v", ErrInvalidOption, latency)
+		}
+		c.batchSize = size
+		c.batchLatency = latency
+		c.outputOnly = append(c.outputOnly, "batching")
+		return nil
+	}
+}
+
+// Open opens device for the input if it is an input device, otherwise for the output,
+// the result is either *InputStream or *OutputStream. Use OpenInput or OpenOutput
+// to get a typed stream.
+func Open(id DeviceID, opts ...Option) (Stream, error) {
+	info := GetDeviceInfo(id)
+	if info == nil {
+		if !initialized() {
+			return nil, ErrNotInitialized
+		}
+		return nil, pm.ErrInvalidDeviceID
+	}
+	if info.IsInputAvailable {
+		return OpenInput(id, opts...)
+	}
+	return OpenOutput(id, opts...)
+}
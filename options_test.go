@@ -0,0 +1,80 @@
+package portmidi
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOptionDirection(t *testing.T) {
+	drv := useVirtualDriver(t)
+	outID, inID := drv.AddLoopback("Loop")
+
+	outputTests := []struct {
+		name string
+		opt  Option
+	}{
+		{"filter", WithFilter(FilterClock)},
+		{"channel mask", WithChannelMask(Channel(1))},
+		{"backpressure", WithBackpressure(DropOldest)},
+		{"sysex buffer size", WithSysExBufferSize(64)},
+		{"event handler", WithEventHandler(func(Event) {})},
+	}
+	for _, tt := range outputTests {
+		if _, err := OpenOutput(outID, tt.opt); !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("%s on an output: got %v, want ErrInvalidOption", tt.name, err)
+		}
+	}
+	inputTests := []struct {
+		name string
+		opt  Option
+	}{
+		{"latency", WithLatency(10)},
+		{"scheduler", WithScheduler(time.Millisecond)},
+		{"batching", WithBatching(8, 0)},
+		{"sysex chunks", WithSysExChunks(64, 0)},
+		{"error policy", WithErrorPolicy(StopOnError)},
+	}
+	for _, tt := range inputTests {
+		if _, err := OpenInput(inID, tt.opt); !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("%s on an input: got %v, want ErrInvalidOption", tt.name, err)
+		}
+	}
+	if _, err := NewOutputStream(outID, 0, 0, 0, FilterClock); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("NewOutputStream with a filter: got %v, want ErrInvalidOption", err)
+	}
+	if _, err := OpenInput(inID, WithBufferSize(0)); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("zero buffer size: got %v, want ErrInvalidOption", err)
+	}
+	if _, err := OpenInput(inID, WithHandlerWorkers(2)); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("handler workers without a handler: got %v, want ErrInvalidOption", err)
+	}
+	if GetDeviceInfo(inID).IsOpened || GetDeviceInfo(outID).IsOpened {
+		t.Error("a device has been opened with invalid options")
+	}
+}
+
+func TestOpenDirection(t *testing.T) {
+	drv := useVirtualDriver(t)
+	outID, inID := drv.AddLoopback("Loop")
+
+	in, err := Open(inID, WithFilter(FilterClock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	if _, ok := in.(*InputStream); !ok {
+		t.Errorf("got %T for an input device, want *InputStream", in)
+	}
+	out, err := Open(outID, WithLatency(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if _, ok := out.(*OutputStream); !ok {
+		t.Errorf("got %T for an output device, want *OutputStream", out)
+	}
+	if _, err := Open(outID+inID+1, WithLatency(5)); err == nil {
+		t.Error("opened a device that does not exist")
+	}
+}
@@ -0,0 +1,679 @@
+package portmidi
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xlab/portmidi/pm"
+)
+
+// OutputStream is a stream opened for the output, events to send are written into Sink.
+type OutputStream struct {
+	// batchLatency and queued come first to be aligned for the atomic operations
+	// on 32-bit platforms, queued is the length of queue for the statistics.
+	batchLatency int64
+	queued       int64
+	baseStream
+	buf     chan Event
+	closeC  chan struct{}
+	doneC   chan struct{}
+	errC    chan *WriteError
+	policy  int32
+	aborted int32
+	// batchSize is the number of events gathered into a write, see WithBatching.
+	batchSize int32
+
+	// queue holds the events of a stream with a scheduler, owned by the output goroutine,
+	// wake interrupts the wait for the next event.
+	queue     eventQueue
+	seq       uint64
+	latency   time.Duration
+	tolerance time.Duration
+	wake      chan struct{}
+
+	// wmux serializes the writes, so the other events do not get in the middle of a SysEx
+	// message sent in chunks while mux is released between them. It is taken before mux.
+	wmux sync.Mutex
+	// wbuf is a batch of raw events for the driver, guarded by mux.
+	wbuf []Event
+	// SysEx messages longer than chunkSize are sent in chunks, see WithSysExChunks.
+	chunkSize  int
+	chunkPause time.Duration
+
+	errMux sync.Mutex
+	err    error
+}
+
+// WriteError reports a failed write of an event to an output stream, or an event sent late
+// by the scheduler, see LateError.
+type WriteError struct {
+	// Event is the event that caused the error, e.g. an invalid SysEx message, or the first
+	// event of the failed write when the driver does not tell which one has failed.
+	Event Event
+	// Batch holds all the events of the failed write.
+	Batch []Event
+	Err   error
+}
+
+func (e *WriteError) Error() string {
+	var err *Error
+	if errors.As(e.Err, &err) {
+		return err.Error()
+	}
+	var late *LateError
+	if errors.As(e.Err, &late) {
+		return late.Error()
+	}
+	return "portmidi: write failed: " + e.Err.Error()
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorPolicy specifies how an output stream handles failed writes.
+type ErrorPolicy int32
+
+const (
+	// ContinueOnError reports failed writes and keeps sending the next events.
+	ContinueOnError ErrorPolicy = iota
+	// StopOnError stops the stream after the first fatal error, e.g. a host error,
+	// the events written into Sink after that are discarded. Bad data or a buffer
+	// overflow are not considered fatal.
+	StopOnError
+)
+
+// ErrAborted is returned by writes to an aborted output stream.
+var ErrAborted = errors.New("portmidi: stream aborted")
+
+// errorsBufferSize is the capacity of the Errors channel.
+const errorsBufferSize = 64
+
+// DefaultBatchSize is the default maximum number of events sent with a single write.
+const DefaultBatchSize = 256
+
+var _ Stream = (*OutputStream)(nil)
+
+// NewOutputStream opens device for the output. The buffersize
+// specifies the number of output events to be buffered waiting for output.
+// (In some cases -- see below -- PortMidi does not buffer output at all
+// and merely passes data to a lower-level API, in which case buffersize
+// is ignored.)
+//
+// latency is the delay in milliseconds applied to timestamps to determine
+// when the output should actually occur. (If latency is < 0, 0 is assumed.)
+// If latency is zero, timestamps are ignored and all output is delivered
+// immediately. If latency is greater than zero, output is delayed until the
+// message timestamp plus the latency. (NOTE: the time is measured relative
+// to the time source of the stream, see SetClock and Now. Timestamps are absolute,
+// not relative delays or offsets.) In some cases, PortMidi can obtain
+// better timing than your application by passing timestamps along to the
+// device driver or hardware. Latency may also help you to synchronize midi
+// data to audio data by matching midi latency to the audio buffer latency.
+//
+// NewOutputStream is a shorthand for OpenOutput with the corresponding options. Channel mask
+// and filters do not apply to the output, pass 0 and no filters, otherwise ErrInvalidOption
+// is returned.
+func NewOutputStream(id DeviceID, bufferSize, latency int,
+	channels ChannelMask, filters ...Filter) (*OutputStream, error) {
+
+	opts := []Option{WithLatency(latency)}
+	if bufferSize > 0 {
+		opts = append(opts, WithBufferSize(bufferSize))
+	}
+	if channels > 0 {
+		opts = append(opts, WithChannelMask(channels))
+	}
+	if len(filters) > 0 {
+		opts = append(opts, WithFilter(filters...))
+	}
+	return OpenOutput(id, opts...)
+}
+
+// OpenOutput opens device for the output with the given options,
+// options that apply only to the input are rejected with ErrInvalidOption.
+func OpenOutput(id DeviceID, opts ...Option) (*OutputStream, error) {
+	c, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.validate(false); err != nil {
+		return nil, err
+	}
+	lib.mux.Lock()
+	defer lib.mux.Unlock()
+	if lib.refs == 0 {
+		return nil, ErrNotInitialized
+	}
+	openStreams.mux.Lock()
+	defer openStreams.mux.Unlock()
+	stream, err := driver.OpenOutput(id, c.streamConfig())
+	if err != nil {
+		return nil, newError("open", id, keyOf(id).Name, err)
+	}
+	s := &OutputStream{
+		baseStream: baseStream{
+			stream: stream,
+			id:     id,
+			key:    keyOf(id),
+			config: c.streamConfig(),
+			clock:  streamClock(c.clock),
+			stats:  newCounters(),
+		},
+		buf:          make(chan Event, c.bufferSize),
+		closeC:       make(chan struct{}),
+		doneC:        make(chan struct{}),
+		errC:         make(chan *WriteError, errorsBufferSize),
+		policy:       int32(c.policy),
+		batchSize:    int32(c.batchSize),
+		batchLatency: int64(c.batchLatency),
+		chunkSize:    c.chunkSize,
+		chunkPause:   c.chunkPause,
+	}
+	track(s)
+	if c.scheduler {
+		s.latency = time.Duration(c.latency) * time.Millisecond
+		s.tolerance = c.tolerance
+		s.wake = make(chan struct{}, 1)
+		go s.processScheduled()
+	} else {
+		go s.processOutput()
+	}
+	return s, nil
+}
+
+func (s *OutputStream) base() *baseStream {
+	return &s.baseStream
+}
+
+func (s *OutputStream) isInput() bool {
+	return false
+}
+
+// attach sets up a newly opened driver stream, outputs have no settings of their own.
+func (s *OutputStream) attach(stream DriverStream) error {
+	return nil
+}
+
+// Close closes a midi stream, flushing the events queued in Sink. Subsequent calls return ErrClosed.
+// With a scheduler, Close also waits for the scheduled events to be due, see WithScheduler.
+// Stop writing into Sink before Close: the events written after it are not sent and, once
+// the buffer of Sink is full, a write into it blocks forever.
+func (s *OutputStream) Close() error {
+	return s.CloseContext(context.Background())
+}
+
+// CloseContext closes a midi stream like Close, but if the queued events have not
+// been flushed before ctx is done, the rest of them is dropped and the output is aborted.
+// If a write blocked in the driver does not return by then, CloseContext returns ctx.Err()
+// and the stream is closed in the background as soon as the write returns.
+func (s *OutputStream) CloseContext(ctx context.Context) error {
+	if !s.beginClose() {
+		return ErrClosed
+	}
+	close(s.closeC)
+	select {
+	case <-s.doneC:
+	case <-ctx.Done():
+		s.abortQueued()
+		select {
+		case <-s.doneC:
+		default:
+			go func() {
+				s.Abort()
+				<-s.doneC
+				s.finishClose()
+			}()
+			return ctx.Err()
+		}
+		s.Abort()
+	}
+	return s.finishClose()
+}
+
+// finishClose closes the driver stream once the output loop has stopped.
+func (s *OutputStream) finishClose() error {
+	err := s.closeStream()
+	untrack(s)
+	if s.session != nil {
+		s.session.forget(s)
+	}
+	return err
+}
+
+// Abort drops the events queued in Sink and terminates outgoing messages immediately,
+// which may result in transmission of a partial MIDI message. The stream should be
+// closed after Abort, all the writes to an aborted stream fail with ErrAborted.
+func (s *OutputStream) Abort() error {
+	s.abortQueued()
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.stream == nil {
+		return ErrClosed
+	}
+	return s.wrap("abort", s.stream.Abort())
+}
+
+// abortQueued marks the stream aborted and drops the events queued in Sink,
+// the scheduler drops its queue when it wakes up.
+func (s *OutputStream) abortQueued() {
+	atomic.StoreInt32(&s.aborted, 1)
+	s.dropQueued()
+	if s.wake != nil {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// dropQueued drops the events queued in Sink.
+func (s *OutputStream) dropQueued() {
+	for len(s.buf) > 0 {
+		select {
+		case <-s.buf:
+			atomic.AddUint64(&s.stats.dropped, 1)
+		default:
+		}
+	}
+}
+
+// Synchronize instructs PortMidi to (re)synchronize to the time source used by the stream.
+// PortMidi will always synchronize at the first output message and periodically thereafter.
+func (s *OutputStream) Synchronize() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.stream == nil {
+		return ErrClosed
+	}
+	return s.wrap("synchronize", s.stream.Synchronize())
+}
+
+func (s *OutputStream) isAborted() bool {
+	return atomic.LoadInt32(&s.aborted) == 1
+}
+
+// Stats returns the statistics of the stream. Events and SysExBytes count the written
+// events, QueueDepth is the number of events waiting in Sink and in the scheduler queue.
+func (s *OutputStream) Stats() Stats {
+	return s.stats.snapshot(len(s.buf) + int(atomic.LoadInt64(&s.queued)))
+}
+
+// Sink returns a channel that accepts events to be sent to the device. A SysEx message that
+// is not valid, see Write, is skipped and reported on Errors, the other events are sent.
+func (s *OutputStream) Sink() chan<- Event {
+	return s.buf
+}
+
+// Write sends the events to the device in a single batch and returns after they have been
+// handed to the driver. SysEx events are packed into the batch the way PortMidi expects them,
+// unless a SysEx message is not framed by F0 and F7 or has a data byte above 0x7F, in which case
+// nothing is written and the error wraps pm.ErrBadData.
+// It is safe to use Write next to Sink, but the order of events sent through Sink relative
+// to the events passed to Write is not defined. Write bypasses the scheduler, see WithScheduler.
+func (s *OutputStream) Write(ctx context.Context, events ...Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	s.wmux.Lock()
+	defer s.wmux.Unlock()
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.stream == nil {
+		return ErrClosed
+	}
+	if s.isAborted() {
+		return ErrAborted
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err := s.write(events)
+	if err != nil {
+		s.checkFatal(err)
+	}
+	return err
+}
+
+// write packs the events into a batch and writes it, then checks the stream for a host error.
+// SysEx messages are validated before anything is written, the long ones are sent in chunks
+// between the batches. On failure it returns the index of the event that caused the error,
+// that is the first event of the failed batch when the driver does not tell which one has
+// failed. s.wmux and s.mux must be held.
+func (s *OutputStream) write(events []Event) (int, error) {
+	for i := range events {
+		if data := events[i].SysExData; len(data) > 0 && !validSysEx(data) {
+			atomic.AddUint64(&s.stats.writeErrors, 1)
+			return i, s.wrap("write", pm.ErrBadData)
+		}
+	}
+	s.wbuf = s.wbuf[:0]
+	start := 0 // the first event packed in wbuf
+	for i, ev := range events {
+		switch {
+		case len(ev.SysExData) == 0:
+			s.wbuf = append(s.wbuf, Event{
+				Timestamp: ev.Timestamp,
+				Message:   ev.Message,
+			})
+		case s.chunkSize == 0 || len(ev.SysExData) <= s.chunkSize:
+			s.wbuf = appendSysEx(s.wbuf, ev.Timestamp, ev.SysExData)
+		default:
+			if err := s.send(events[start:i]); err != nil {
+				return start, err
+			}
+			if err := s.writeChunks(&events[i]); err != nil {
+				return i, err
+			}
+			start = i + 1
+		}
+	}
+	if err := s.send(events[start:]); err != nil {
+		return start, err
+	}
+	return 0, s.hostError("write")
+}
+
+// send writes the events packed in wbuf and counts the events they have been packed from.
+// s.mux must be held.
+func (s *OutputStream) send(events []Event) error {
+	if len(s.wbuf) == 0 {
+		return nil
+	}
+	err := s.stream.Write(s.wbuf)
+	s.wbuf = s.wbuf[:0]
+	if err != nil {
+		atomic.AddUint64(&s.stats.writeErrors, 1)
+		return s.wrap("write", err)
+	}
+	for i := range events {
+		s.stats.count(&events[i])
+	}
+	return nil
+}
+
+// writeChunks writes a long SysEx message in chunks, pausing between them. s.wmux and s.mux
+// must be held, s.mux is released during the pauses, so Abort and the other operations on the
+// stream do not wait for the whole message. The rest of the message is not sent if the stream
+// has been closed, aborted or reopened by Rescan in the meantime.
+func (s *OutputStream) writeChunks(ev *Event) error {
+	stream := s.stream
+	data := ev.SysExData
+	for len(data) > 0 {
+		n := s.chunkSize
+		if n > len(data) {
+			n = len(data)
+		}
+		s.wbuf = appendSysEx(s.wbuf, ev.Timestamp, data[:n])
+		if err := s.send(nil); err != nil {
+			return err
+		}
+		data = data[n:]
+		if len(data) == 0 {
+			break
+		}
+		if s.chunkPause > 0 {
+			s.mux.Unlock()
+			time.Sleep(s.chunkPause)
+			s.mux.Lock()
+		}
+		switch {
+		case s.stream == nil:
+			return ErrClosed
+		case s.isAborted():
+			return ErrAborted
+		case s.stream != stream:
+			return s.wrap("write", ErrDeviceRemoved)
+		}
+	}
+	s.stats.count(ev)
+	return nil
+}
+
+// WriteSysEx sends a complete SysEx message including F0 and F7 and returns after it has been
+// handed to the driver. The message is validated like by Write and copied, so data may be reused
+// afterwards. Long messages are sent in chunks, see WithSysExChunks.
+func (s *OutputStream) WriteSysEx(ctx context.Context, timestamp Timestamp, data []byte) error {
+	if !validSysEx(data) {
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		atomic.AddUint64(&s.stats.writeErrors, 1)
+		return s.wrap("write", pm.ErrBadData)
+	}
+	if s.chunkSize > 0 && len(data) > s.chunkSize {
+		return s.Write(ctx, Event{
+			Timestamp: timestamp,
+			Message:   Message(sysExStart),
+			SysExData: data,
+		})
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	s.wmux.Lock()
+	defer s.wmux.Unlock()
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.stream == nil {
+		return ErrClosed
+	}
+	if s.isAborted() {
+		return ErrAborted
+	}
+	if err := s.stream.WriteSysEx(timestamp, data); err != nil {
+		atomic.AddUint64(&s.stats.writeErrors, 1)
+		err = s.wrap("write", err)
+		s.checkFatal(err)
+		return err
+	}
+	ev := Event{SysExData: data}
+	s.stats.count(&ev)
+	return s.hostError("write")
+}
+
+// Errors returns a channel that reports each failed write along with the event that caused it,
+// as well as the events sent late by the scheduler, see WithScheduler.
+// The channel is buffered, when it is full the reports are dropped rather than blocking the output.
+// It is closed when the stream is closed.
+func (s *OutputStream) Errors() <-chan *WriteError {
+	return s.errC
+}
+
+// Err returns the fatal error that stopped the stream under StopOnError policy, or nil.
+func (s *OutputStream) Err() error {
+	s.errMux.Lock()
+	defer s.errMux.Unlock()
+	return s.err
+}
+
+// SetErrorPolicy sets how failed writes are handled, the default is ContinueOnError.
+func (s *OutputStream) SetErrorPolicy(policy ErrorPolicy) {
+	atomic.StoreInt32(&s.policy, int32(policy))
+}
+
+// SetBatching configures aggregation of the events written into Sink: when events queue up,
+// up to size of them are sent with a single write. After the first event of a batch the output
+// waits at most latency for more events, so the default zero latency only batches the events
+// that are already queued. SysEx messages are never split between batches. Size 1 disables
+// batching, size <= 0 restores DefaultBatchSize.
+func (s *OutputStream) SetBatching(size int, latency time.Duration) {
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	atomic.StoreInt32(&s.batchSize, int32(size))
+	atomic.StoreInt64(&s.batchLatency, int64(latency))
+}
+
+func (s *OutputStream) processOutput() {
+	defer close(s.doneC)
+	defer close(s.errC)
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	var batch []Event
+	for {
+		select {
+		case <-s.closeC:
+			s.flushQueued(batch)
+			s.dropQueued() // written after Close
+			return
+		case ev, ok := <-s.buf:
+			if !ok { // s.buf closed
+				return
+			}
+			var done bool
+			batch, done = s.gather(append(batch[:0], ev), timer)
+			s.writeBatch(batch)
+			if done {
+				return
+			}
+		}
+	}
+}
+
+// gather appends the queued events to batch up to the batch size, waiting for more
+// within the batch latency. It reports whether the events channel has been closed.
+func (s *OutputStream) gather(batch []Event, timer *time.Timer) ([]Event, bool) {
+	size := int(atomic.LoadInt32(&s.batchSize))
+	var deadline <-chan time.Time
+	if latency := time.Duration(atomic.LoadInt64(&s.batchLatency)); latency > 0 {
+		timer.Reset(latency)
+		deadline = timer.C
+		defer func() {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		}()
+	}
+	for len(batch) < size {
+		select {
+		case ev, ok := <-s.buf:
+			if !ok {
+				return batch, true
+			}
+			batch = append(batch, ev)
+			continue
+		default:
+		}
+		if deadline == nil {
+			break
+		}
+		select {
+		case ev, ok := <-s.buf:
+			if !ok {
+				return batch, true
+			}
+			batch = append(batch, ev)
+		case <-deadline:
+			deadline = nil
+		case <-s.closeC:
+			deadline = nil
+		}
+	}
+	return batch, false
+}
+
+// flushQueued writes the events queued at the moment of the call, unless the stream is aborted.
+func (s *OutputStream) flushQueued(batch []Event) {
+	size := int(atomic.LoadInt32(&s.batchSize))
+	for n := len(s.buf); n > 0 && !s.isAborted(); {
+		batch = batch[:0]
+	loop:
+		for n > 0 && len(batch) < size {
+			select {
+			case ev := <-s.buf:
+				batch = append(batch, ev)
+				n--
+			default:
+				n = 0
+				break loop
+			}
+		}
+		if len(batch) > 0 {
+			s.writeBatch(batch)
+		}
+	}
+}
+
+func (s *OutputStream) writeBatch(batch []Event) {
+	if s.Err() != nil || s.isAborted() { // stopped
+		atomic.AddUint64(&s.stats.dropped, uint64(len(batch)))
+		return
+	}
+	s.wmux.Lock()
+	defer s.wmux.Unlock()
+	s.mux.Lock()
+	batch = s.skipInvalid(batch)
+	if len(batch) == 0 {
+		s.mux.Unlock()
+		return
+	}
+	i, err := s.write(batch)
+	s.mux.Unlock()
+	switch {
+	case err == ErrAborted: // in the middle of a SysEx message sent in chunks
+		atomic.AddUint64(&s.stats.dropped, uint64(len(batch)-i))
+	case err != nil:
+		s.reportError(batch, i, err)
+	}
+}
+
+// skipInvalid reports the invalid SysEx messages of batch and returns the rest of the events,
+// so a bad message written into Sink does not fail the events around it. s.mux must be held.
+func (s *OutputStream) skipInvalid(batch []Event) []Event {
+	n := 0
+	for i := range batch {
+		if data := batch[i].SysExData; len(data) > 0 && !validSysEx(data) {
+			atomic.AddUint64(&s.stats.writeErrors, 1)
+			s.reportError(batch[i:i+1], 0, s.wrap("write", pm.ErrBadData))
+			continue
+		}
+		batch[n] = batch[i]
+		n++
+	}
+	return batch[:n]
+}
+
+// reportError reports the failed write of batch, failed is the index of the event that caused it.
+func (s *OutputStream) reportError(batch []Event, failed int, err error) {
+	select {
+	case s.errC <- &WriteError{
+		Event: batch[failed],
+		Batch: append([]Event(nil), batch...),
+		Err:   err,
+	}:
+	default:
+	}
+	s.checkFatal(err)
+}
+
+// checkFatal stops the stream if err is fatal under StopOnError policy.
+func (s *OutputStream) checkFatal(err error) {
+	if ErrorPolicy(atomic.LoadInt32(&s.policy)) == StopOnError && isFatal(err) {
+		s.errMux.Lock()
+		s.err = err
+		s.errMux.Unlock()
+	}
+}
+
+// isFatal reports whether a write error leaves the stream unusable.
+func isFatal(err error) bool {
+	switch {
+	case errors.Is(err, pm.ErrBadData),
+		errors.Is(err, pm.ErrBufferOverflow),
+		errors.Is(err, pm.ErrBufferTooSmall):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,178 @@
+package portmidi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/xlab/portmidi/pm"
+)
+
+func TestWriteErrorEvent(t *testing.T) {
+	drv := useVirtualDriver(t)
+	out, in := openLoopback(t, drv, WithSysExChunks(4, 0))
+	defer in.Close()
+	defer out.Close()
+
+	out.mux.Lock()
+	drv.Remove(0) // the output of the loopback, the writes fail with a host error
+	events := []Event{
+		{Message: NewMessage(0x90, 60, 100)},
+		{SysExData: []byte{0xF0, 1, 2, 3, 4, 5, 0xF7}}, // sent in chunks
+		{Message: NewMessage(0x80, 60, 0)},
+	}
+	i, err := out.write(events)
+	out.mux.Unlock()
+	if err == nil || i != 0 {
+		t.Errorf("got error %v at %d, want an error at 0", err, i)
+	}
+}
+
+func TestSinkSkipsInvalidSysEx(t *testing.T) {
+	drv := useVirtualDriver(t)
+	out, in := openLoopback(t, drv)
+	defer in.Close()
+	defer out.Close()
+
+	bad := []byte{0xF0, 0x01, 0x80, 0xF7}
+	on, off := NewMessage(0x90, 60, 100), NewMessage(0x80, 60, 0)
+	out.writeBatch([]Event{{Message: on}, {SysExData: bad}, {Message: off}})
+	select {
+	case werr := <-out.Errors():
+		if !errors.Is(werr, pm.ErrBadData) {
+			t.Errorf("got error %v, want bad data", werr)
+		}
+		if !bytes.Equal(werr.Event.SysExData, bad) || len(werr.Batch) != 1 {
+			t.Errorf("got failed event %v in %v, want the invalid SysEx alone", werr.Event, werr.Batch)
+		}
+	default:
+		t.Fatal("no error reported")
+	}
+	for _, want := range []Message{on, off} {
+		if ev := receive(t, in); ev.Message != want || ev.Err != nil {
+			t.Errorf("got %v, want %v", ev, want)
+		}
+	}
+}
+
+func TestSysExChunks(t *testing.T) {
+	drv := useVirtualDriver(t)
+	if _, err := OpenOutput(drv.AddOutput("Out"), WithSysExChunks(5, 0)); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("chunks of 5 bytes: got %v, want ErrInvalidOption", err)
+	}
+	out, in := openLoopback(t, drv, WithSysExChunks(8, time.Millisecond))
+	defer in.Close()
+	defer out.Close()
+
+	var dumps [][]byte
+	for _, n := range []int{5, 9, 12, 17, 30} {
+		dump := []byte{0xF0}
+		for i := 1; i < n-1; i++ {
+			dump = append(dump, byte(i))
+		}
+		dumps = append(dumps, append(dump, 0xF7))
+	}
+	if err := out.WriteSysEx(context.Background(), 0, dumps[3]); err != nil {
+		t.Fatal(err)
+	}
+	if ev := receive(t, in); !bytes.Equal(ev.SysExData, dumps[3]) || ev.Err != nil {
+		t.Errorf("got %v, want SysEx % X", ev, dumps[3])
+	}
+	for _, dump := range dumps {
+		out.Sink() <- Event{SysExData: dump}
+	}
+	for _, want := range dumps {
+		if ev := receive(t, in); !bytes.Equal(ev.SysExData, want) || ev.Err != nil {
+			t.Errorf("got %v, want SysEx % X", ev, want)
+		}
+	}
+}
+
+func TestAbortSysExChunks(t *testing.T) {
+	drv := useVirtualDriver(t)
+	out, in := openLoopback(t, drv, WithSysExChunks(4, 100*time.Millisecond))
+	defer in.Close()
+	defer out.Close()
+
+	dump := append(make([]byte, 39), 0xF7) // 10 chunks, 900ms of pauses
+	dump[0] = 0xF0
+	errC := make(chan error, 1)
+	go func() {
+		errC <- out.WriteSysEx(context.Background(), 0, dump)
+	}()
+	time.Sleep(150 * time.Millisecond)
+	start := time.Now()
+	if err := out.Abort(); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Errorf("abort took %v", d)
+	}
+	select {
+	case err := <-errC:
+		if err != ErrAborted {
+			t.Errorf("got %v, want ErrAborted", err)
+		}
+	case <-time.After(300 * time.Millisecond):
+		t.Fatal("the dump has not been cut short")
+	}
+	if st := out.Stats(); st.Events != 0 || st.SysExBytes != 0 {
+		t.Errorf("got %+v, want the dump not counted", st)
+	}
+}
+
+func TestCloseContextAbort(t *testing.T) {
+	drv := useVirtualDriver(t)
+	outID, _ := drv.AddLoopback("Loop")
+	out, err := OpenOutput(outID, WithScheduler(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Sink() <- Event{Timestamp: out.Timestamp(time.Now().Add(time.Hour)), Message: NewMessage(0x90, 60, 100)}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := out.CloseContext(ctx); err != nil && err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("close took %v", d)
+	}
+	waitFor(t, "the device to be closed", func() bool { return !GetDeviceInfo(outID).IsOpened })
+	if st := out.Stats(); st.Dropped != 1 || st.QueueDepth != 0 {
+		t.Errorf("got %+v, want the scheduled event dropped", st)
+	}
+}
+
+func TestCloseStopsGoroutines(t *testing.T) {
+	drv := useVirtualDriver(t)
+	base := runtime.NumGoroutine()
+	for _, opts := range [][]Option{nil, {WithScheduler(0)}} {
+		out, in := openLoopback(t, drv, opts...)
+		for i := 0; i < 4; i++ {
+			out.Sink() <- Event{Message: NewMessage(0x90, byte(i), 100)}
+		}
+		if err := out.Close(); err != nil {
+			t.Fatal(err)
+		}
+		out.Sink() <- Event{Message: NewMessage(0x80, 0, 0)} // after Close, not sent
+		if err := in.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "the goroutines to exit", func() bool { return runtime.NumGoroutine() <= base })
+}
+
+// waitFor fails the test if cond does not become true within a second.
+func waitFor(tb testing.TB, what string, cond func() bool) {
+	tb.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			tb.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,85 @@
+package pm
+
+/*
+#cgo LDFLAGS: -lportmidi
+#include "portmidi.h"
+#include <stdlib.h>
+*/
+import "C"
+import "unsafe"
+
+// EventBuffer is an array of PmEvent allocated in C memory. Unlike Read and Write that
+// copy every event between Go and C, ReadBuffer and WriteBuffer use the array in place,
+// so a buffer can be reused for streaming without allocations.
+type EventBuffer struct {
+	ptr    *C.PmEvent
+	events []C.PmEvent
+}
+
+// NewEventBuffer allocates a buffer for size events, it must be released with Free.
+func NewEventBuffer(size int) *EventBuffer {
+	if size < 1 {
+		size = 1
+	}
+	ptr := (*C.PmEvent)(allocEventMemory(size))
+	const m = 0x7fffffff
+	return &EventBuffer{
+		ptr:    ptr,
+		events: (*[m / sizeOfEventValue]C.PmEvent)(unsafe.Pointer(ptr))[:size:size],
+	}
+}
+
+// Len returns the capacity of the buffer in events.
+func (b *EventBuffer) Len() int {
+	return len(b.events)
+}
+
+// Event returns the message and the timestamp of the i-th event.
+func (b *EventBuffer) Event(i int) (Message, Timestamp) {
+	ev := &b.events[i]
+	return Message(ev.message), Timestamp(ev.timestamp)
+}
+
+// SetEvent sets the message and the timestamp of the i-th event.
+func (b *EventBuffer) SetEvent(i int, msg Message, when Timestamp) {
+	ev := &b.events[i]
+	ev.message = C.PmMessage(msg)
+	ev.timestamp = C.PmTimestamp(when)
+}
+
+// Free releases the C memory of the buffer.
+func (b *EventBuffer) Free() {
+	if b.ptr != nil {
+		C.free(unsafe.Pointer(b.ptr))
+		b.ptr = nil
+		b.events = nil
+	}
+}
+
+// ReadBuffer reads up to length events into the buffer, see Read.
+func ReadBuffer(stream *PortMidiStream, buffer *EventBuffer, length int32) int32 {
+	if int(length) > len(buffer.events) {
+		length = int32(len(buffer.events))
+	}
+	return int32(C.Pm_Read(unsafe.Pointer(stream), buffer.ptr, C.int32_t(length)))
+}
+
+// WriteBuffer writes length events from the buffer, see Write.
+func WriteBuffer(stream *PortMidiStream, buffer *EventBuffer, length int32) Error {
+	if int(length) > len(buffer.events) {
+		return buffertoosmall
+	}
+	return Error(C.Pm_Write(unsafe.Pointer(stream), buffer.ptr, C.int32_t(length)))
+}
+
+// WriteSysExCopy writes a SysEx message like WriteSysEx, but it copies msg into C memory first,
+// so PortMidi never reads Go memory. PortMidi scans the message up to EOX, so unless msg starts
+// with F0 and ends with F7 it returns BadData without calling PortMidi.
+func WriteSysExCopy(stream *PortMidiStream, when Timestamp, msg []byte) Error {
+	if len(msg) < 2 || msg[0] != 0xF0 || msg[len(msg)-1] != 0xF7 {
+		return baddata
+	}
+	cmsg := C.CBytes(msg)
+	defer C.free(cmsg)
+	return Error(C.Pm_WriteSysEx(unsafe.Pointer(stream), C.PmTimestamp(when), (*C.uchar)(cmsg)))
+}
@@ -0,0 +1,72 @@
+package pm
+
+import "testing"
+
+func BenchmarkEventBuffer(b *testing.B) {
+	buf := NewEventBuffer(128)
+	defer buf.Free()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		j := i % buf.Len()
+		buf.SetEvent(j, Message(i), Timestamp(i))
+		if msg, ts := buf.Event(j); msg != Message(i) || ts != Timestamp(i) {
+			b.Fatal(msg, ts)
+		}
+	}
+}
+
+// openDefault initializes PortMidi and opens the default device, it skips the benchmark
+// if there is none.
+func openDefault(b *testing.B, input bool) *PortMidiStream {
+	if err := ToError(Initialize()); err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { Terminate() })
+	id := GetDefaultOutputDeviceID()
+	if input {
+		id = GetDefaultInputDeviceID()
+	}
+	if CountDevices() == 0 || id == NoDevice {
+		b.Skip("no MIDI device")
+	}
+	var stream *PortMidiStream
+	var err error
+	if input {
+		err = ToError(OpenInput(&stream, id, nil, 1024, nil, nil))
+	} else {
+		err = ToError(OpenOutput(&stream, id, nil, 1024, nil, nil, 0))
+	}
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { Close(stream) })
+	return stream
+}
+
+func BenchmarkWriteBuffer(b *testing.B) {
+	stream := openDefault(b, false)
+	buf := NewEventBuffer(1)
+	defer buf.Free()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// active sensing is ignored by most devices
+		buf.SetEvent(0, 0xFE, 0)
+		if err := ToError(WriteBuffer(stream, buf, 1)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadBuffer(b *testing.B) {
+	stream := openDefault(b, true)
+	buf := NewEventBuffer(128)
+	defer buf.Free()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if n := ReadBuffer(stream, buf, 128); n < 0 {
+			b.Fatal(ToError(Error(n)))
+		}
+	}
+}
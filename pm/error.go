@@ -10,6 +10,22 @@ var False Error = 0
 
 const NoDevice = nodevice
 
+// Error codes returned by PortMidi functions, see ToError.
+const (
+	NoError            = noerror
+	NoData             = nodata
+	GotData            = gotdata
+	HostError          = hosterror
+	InvalidDeviceID    = invaliddeviceid
+	InsufficientMemory = insufficientmemory
+	BufferTooSmall     = buffertoosmall
+	BufferOverflow     = bufferoverflow
+	BadPtr             = badptr
+	BadData            = baddata
+	InternalError      = internalerror
+	BufferMaxSize      = buffermaxsize
+)
+
 var (
 	ErrHostError = errors.New("portmidi: host error")
 	// ErrInvalidDeviceID means out of range or
@@ -66,3 +82,30 @@ func ToError(e Error) error {
 		return fmt.Errorf("portmidi: %s", GetErrorText(e))
 	}
 }
+
+// ErrorCode returns the code of an error returned by ToError, it is the reverse of ToError
+// for the sentinel errors. It returns NoError for nil and InternalError for other errors.
+func ErrorCode(err error) Error {
+	switch {
+	case err == nil:
+		return noerror
+	case errors.Is(err, ErrHostError):
+		return hosterror
+	case errors.Is(err, ErrInvalidDeviceID):
+		return invaliddeviceid
+	case errors.Is(err, ErrInsufficientMemory):
+		return insufficientmemory
+	case errors.Is(err, ErrBufferTooSmall):
+		return buffertoosmall
+	case errors.Is(err, ErrBufferOverflow):
+		return bufferoverflow
+	case errors.Is(err, ErrBadPtr):
+		return badptr
+	case errors.Is(err, ErrBadData):
+		return baddata
+	case errors.Is(err, ErrBufferMaxSize):
+		return buffermaxsize
+	default:
+		return internalerror
+	}
+}
@@ -0,0 +1,72 @@
+package pm
+
+/*
+#cgo LDFLAGS: -lportmidi
+#include "porttime.h"
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"sync"
+	"unsafe"
+)
+
+// TimeError is a PortTime error code.
+type TimeError int32
+
+const (
+	TimeNoError            TimeError = C.ptNoError
+	TimeHostError          TimeError = C.ptHostError
+	TimeAlreadyStarted     TimeError = C.ptAlreadyStarted
+	TimeAlreadyStopped     TimeError = C.ptAlreadyStopped
+	TimeInsufficientMemory TimeError = C.ptInsufficientMemory
+)
+
+// PtStart starts the PortTime millisecond timer, the time advances every resolution ms.
+// PortMidi starts the timer itself when a stream is opened with no time proc.
+func PtStart(resolution int32) TimeError {
+	return TimeError(C.Pt_Start(C.int(resolution), nil, nil))
+}
+
+// PtStop stops the PortTime timer.
+func PtStop() TimeError {
+	return TimeError(C.Pt_Stop())
+}
+
+// PtStarted returns true iff the PortTime timer is running.
+func PtStarted() bool {
+	return C.Pt_Started() != 0
+}
+
+// PtTime returns the current PortTime time in ms.
+func PtTime() Timestamp {
+	return Timestamp(C.Pt_Time())
+}
+
+// PtSleep pauses for duration ms, allowing other threads to run.
+func PtSleep(duration int32) {
+	C.Pt_Sleep(C.int32_t(duration))
+}
+
+var timeProcs sync.Map
+
+// NewTimeProc registers fn as a time source for a stream. It returns the time proc and
+// the time info to be passed to OpenInput or OpenOutput, and a function that releases
+// the registration after the stream has been closed.
+func NewTimeProc(fn func() Timestamp) (TimeProcPtr, unsafe.Pointer, func()) {
+	// a unique C pointer identifies the stream's time source in callbacks
+	timeInfo := C.malloc(1)
+	timeProcs.Store(timeInfo, fn)
+	release := func() {
+		timeProcs.Delete(timeInfo)
+		C.free(timeInfo)
+	}
+	return dispatchTimeProc, timeInfo, release
+}
+
+func dispatchTimeProc(timeInfo unsafe.Pointer) Timestamp {
+	if fn, ok := timeProcs.Load(timeInfo); ok {
+		return fn.(func() Timestamp)()
+	}
+	return 0
+}
@@ -0,0 +1,211 @@
+package portmidi
+
+import (
+	"unsafe"
+
+	"github.com/xlab/portmidi/pm"
+)
+
+// pmDriver is the default Driver backed by PortMidi.
+type pmDriver struct{}
+
+func (pmDriver) Initialize() error {
+	return pm.ToError(pm.Initialize())
+}
+
+func (pmDriver) Terminate() error {
+	return pm.ToError(pm.Terminate())
+}
+
+func (pmDriver) CountDevices() int {
+	return int(pm.CountDevices())
+}
+
+func (pmDriver) DeviceInfo(id DeviceID) *DeviceInfo {
+	info := pm.GetDeviceInfo(pm.DeviceID(id))
+	if info == nil {
+		return nil
+	}
+	info.Deref()
+	return &DeviceInfo{
+		Interface:         info.Interf,
+		Name:              info.Name,
+		IsInputAvailable:  info.Input > 0,
+		IsOutputAvailable: info.Output > 0,
+		IsOpened:          info.Opened > 0,
+		StructVersion:     int(info.StructVersion),
+	}
+}
+
+func (pmDriver) DefaultInputDeviceID() (DeviceID, bool) {
+	dev := pm.GetDefaultInputDeviceID()
+	if dev == pm.NoDevice {
+		return 0, false
+	}
+	return DeviceID(dev), true
+}
+
+func (pmDriver) DefaultOutputDeviceID() (DeviceID, bool) {
+	dev := pm.GetDefaultOutputDeviceID()
+	if dev == pm.NoDevice {
+		return 0, false
+	}
+	return DeviceID(dev), true
+}
+
+func (pmDriver) HostErrorText() string {
+	buf := make([]byte, pm.HostErrorMsgLen)
+	pm.GetHostErrorText(buf, pm.HostErrorMsgLen)
+	for i := range buf {
+		if buf[i] == 0 {
+			buf = buf[:i]
+			break
+		}
+	}
+	return string(buf)
+}
+
+// Time returns PortTime time, that is used by PortMidi streams opened without a clock.
+func (pmDriver) Time() Timestamp {
+	if !pm.PtStarted() {
+		pm.PtStart(1)
+	}
+	return Timestamp(pm.PtTime())
+}
+
+func (pmDriver) OpenInput(id DeviceID, config StreamConfig) (DriverStream, error) {
+	p := new(pmStream)
+	timeProc, timeInfo := p.timeProc(config.Clock)
+	ret := pm.OpenInput(&p.stream, pm.DeviceID(id), config.DriverInfo,
+		int32(config.BufferSize), timeProc, timeInfo)
+	if err := pm.ToError(ret); err != nil {
+		p.releaseTimeProc()
+		return nil, err
+	}
+	return p, nil
+}
+
+func (pmDriver) OpenOutput(id DeviceID, config StreamConfig) (DriverStream, error) {
+	p := new(pmStream)
+	timeProc, timeInfo := p.timeProc(config.Clock)
+	ret := pm.OpenOutput(&p.stream, pm.DeviceID(id), config.DriverInfo,
+		int32(config.BufferSize), timeProc, timeInfo, int32(config.Latency))
+	if err := pm.ToError(ret); err != nil {
+		p.releaseTimeProc()
+		return nil, err
+	}
+	return p, nil
+}
+
+// pmStream is a DriverStream backed by PortMidi stream. Events are read and written
+// through reusable buffers in C memory to avoid allocations.
+type pmStream struct {
+	stream *pm.PortMidiStream
+	rbuf   *pm.EventBuffer
+	wbuf   *pm.EventBuffer
+	// release unregisters the time proc of the stream.
+	release func()
+}
+
+// timeProc registers clock as the stream time source, nil clock means PortTime.
+func (p *pmStream) timeProc(clock Clock) (pm.TimeProcPtr, unsafe.Pointer) {
+	if clock == nil {
+		return nil, nil
+	}
+	timeProc, timeInfo, release := pm.NewTimeProc(func() pm.Timestamp {
+		return pm.Timestamp(clock.Now())
+	})
+	p.release = release
+	return timeProc, timeInfo
+}
+
+func (p *pmStream) releaseTimeProc() {
+	if p.release != nil {
+		p.release()
+		p.release = nil
+	}
+}
+
+func (p *pmStream) Poll() (bool, error) {
+	ret := pm.Poll(p.stream)
+	if ret == pm.True {
+		return true, nil
+	}
+	return false, pm.ToError(ret)
+}
+
+func (p *pmStream) Read(buf []Event) (int, error) {
+	p.rbuf = growEventBuffer(p.rbuf, len(buf))
+	size := pm.ReadBuffer(p.stream, p.rbuf, int32(len(buf)))
+	if size < 0 {
+		return 0, pm.ToError(pm.Error(size))
+	}
+	for i := 0; i < int(size); i++ {
+		msg, ts := p.rbuf.Event(i)
+		buf[i] = Event{
+			Timestamp: Timestamp(ts),
+			Message:   Message(msg),
+		}
+	}
+	return int(size), nil
+}
+
+func (p *pmStream) Write(buf []Event) error {
+	p.wbuf = growEventBuffer(p.wbuf, len(buf))
+	for i := range buf {
+		p.wbuf.SetEvent(i, pm.Message(buf[i].Message), pm.Timestamp(buf[i].Timestamp))
+	}
+	return pm.ToError(pm.WriteBuffer(p.stream, p.wbuf, int32(len(buf))))
+}
+
+// growEventBuffer returns a buffer that holds at least size events, reusing buf if possible.
+func growEventBuffer(buf *pm.EventBuffer, size int) *pm.EventBuffer {
+	if buf != nil && buf.Len() >= size {
+		return buf
+	}
+	if buf != nil {
+		buf.Free()
+	}
+	return pm.NewEventBuffer(size)
+}
+
+func (p *pmStream) WriteShort(timestamp Timestamp, msg Message) error {
+	return pm.ToError(pm.WriteShort(p.stream, pm.Timestamp(timestamp), int32(msg)))
+}
+
+func (p *pmStream) WriteSysEx(timestamp Timestamp, data []byte) error {
+	return pm.ToError(pm.WriteSysExCopy(p.stream, pm.Timestamp(timestamp), data))
+}
+
+func (p *pmStream) SetFilter(filters Filter) error {
+	return pm.ToError(pm.SetFilter(p.stream, int32(filters)))
+}
+
+func (p *pmStream) SetChannelMask(mask ChannelMask) error {
+	return pm.ToError(pm.SetChannelMask(p.stream, int32(mask)))
+}
+
+func (p *pmStream) HasHostError() bool {
+	return pm.HasHostError(p.stream) > 0
+}
+
+func (p *pmStream) Abort() error {
+	return pm.ToError(pm.Abort(p.stream))
+}
+
+func (p *pmStream) Synchronize() error {
+	return pm.ToError(pm.Synchronize(p.stream))
+}
+
+func (p *pmStream) Close() error {
+	err := pm.ToError(pm.Close(p.stream))
+	p.stream = nil
+	if p.rbuf != nil {
+		p.rbuf.Free()
+	}
+	if p.wbuf != nil {
+		p.wbuf.Free()
+	}
+	p.releaseTimeProc()
+	return err
+}
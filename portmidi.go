@@ -3,56 +3,63 @@ package portmidi
 
 import (
 	"errors"
+	"time"
 
 	"github.com/xlab/portmidi/pm"
 )
 
 // Initialize is the library initialisation function: call this before using portmidi.
+// Each call must be paired with Terminate, see Session.
 func Initialize() error {
-	return pm.ToError(pm.Initialize())
+	return acquire()
 }
 
 // Terminate is the library termination function: call this after using portmidi.
+// It releases the reference taken by Initialize, the library is terminated with the
+// last reference, see Session. That fails with ErrStreamsOpen while any streams are open.
 func Terminate() error {
-	return pm.ToError(pm.Terminate())
+	return release()
 }
 
 // GetHostError translates portmidi host error into human readable message.
+// Errors returned by streams carry the host error text already, see Error.
 func GetHostError() error {
-	buf := make([]byte, pm.HostErrorMsgLen)
-	pm.GetHostErrorText(buf, pm.HostErrorMsgLen)
-	for i := range buf {
-		if buf[i] == 0 {
-			buf = buf[:i]
-			break
-		}
-	}
-	return errors.New(string(buf))
+	return errors.New(driver.HostErrorText())
 }
 
 // CountDevices gets devices count, ids range from 0 to CountDevices()-1.
+// It returns 0 if the library is not initialized.
 func CountDevices() int {
-	return int(pm.CountDevices())
+	lib.mux.Lock()
+	defer lib.mux.Unlock()
+	if lib.refs == 0 {
+		return 0
+	}
+	return driver.CountDevices()
 }
 
 type DeviceID pm.DeviceID
 
-// DefaultOutputDeviceID returns the default output device ID or ok=false if there are no devices.
+// DefaultOutputDeviceID returns the default output device ID or ok=false if there are no devices
+// or the library is not initialized.
 func DefaultOutputDeviceID() (DeviceID, bool) {
-	dev := pm.GetDefaultOutputDeviceID()
-	if dev == pm.NoDevice {
+	lib.mux.Lock()
+	defer lib.mux.Unlock()
+	if lib.refs == 0 {
 		return 0, false
 	}
-	return DeviceID(dev), true
+	return driver.DefaultOutputDeviceID()
 }
 
-// DefaultInputDeviceID returns the default input device ID or ok=false if there are no devices.
+// DefaultInputDeviceID returns the default input device ID or ok=false if there are no devices
+// or the library is not initialized.
 func DefaultInputDeviceID() (DeviceID, bool) {
-	dev := pm.GetDefaultInputDeviceID()
-	if dev == pm.NoDevice {
+	lib.mux.Lock()
+	defer lib.mux.Unlock()
+	if lib.refs == 0 {
 		return 0, false
 	}
-	return DeviceID(dev), true
+	return driver.DefaultInputDeviceID()
 }
 
 type DeviceInfo struct {
@@ -64,27 +71,41 @@ type DeviceInfo struct {
 	IsInputAvailable bool
 	// IsOutputAvailable true iff output is available.
 	IsOutputAvailable bool
+	// IsOpened true iff the device is used by an open stream.
+	IsOpened bool
+	// StructVersion is the version of the PortMidi device info structure,
+	// zero for drivers other than PortMidi.
+	StructVersion int
 }
 
-// GetDeviceInfo returns device info for the provided device ID, or nil if ID is out of range.
+// GetDeviceInfo returns device info for the provided device ID, or nil if ID is out of range
+// or the library is not initialized.
 func GetDeviceInfo(id DeviceID) *DeviceInfo {
-	info := pm.GetDeviceInfo(pm.DeviceID(id))
-	if info == nil {
+	lib.mux.Lock()
+	defer lib.mux.Unlock()
+	if lib.refs == 0 {
 		return nil
 	}
-	info.Deref()
-	return &DeviceInfo{
-		Interface:         info.Interf,
-		Name:              info.Name,
-		IsInputAvailable:  info.Input > 0,
-		IsOutputAvailable: info.Output > 0,
-	}
+	return driver.DeviceInfo(id)
 }
 
 type Event struct {
-	Timestamp int32
+	// Timestamp is the time of the event by the clock of the stream, see Stream.Time.
+	Timestamp Timestamp
 	Message   Message
+	// SysExData holds a complete SysEx message including F0 and F7 bytes,
+	// Message has status 0xF0 for SysEx events received from an input stream.
 	SysExData []byte
+	// Err is set on input events that report an error, e.g. ErrSysExAborted
+	// for a SysEx message interrupted before its end, in that case SysExData
+	// holds the data received so far. Errors of the driver are reported as
+	// *Error, e.g. errors.Is(ev.Err, pm.ErrBufferOverflow) when the input has
+	// lost events or pm.ErrHostError for a host error of the stream. Such events carry
+	// no valid message, skip them when forwarding the input to an output.
+	Err error
+	// Arrival is the Go monotonic time when an input event has been read from the driver,
+	// it is zero for output events.
+	Arrival time.Time
 }
 
 // NewMessage encodes a short MIDI message into a 32-bit word. If data1
@@ -0,0 +1,172 @@
+package portmidi
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMinPollInterval is the poll interval right after input activity.
+	DefaultMinPollInterval = 250 * time.Microsecond
+	// DefaultMaxPollInterval is the poll interval the reader backs off to when idle, the
+	// same as the former fixed poll delay, so an idle input costs no more than it used to.
+	DefaultMaxPollInterval = 5 * time.Millisecond
+)
+
+const (
+	// activeWindow is how long the reader stays responsive after the last input,
+	// it covers the pauses between the notes of a performance.
+	activeWindow = time.Second
+	// activeFactor bounds the poll interval within activeWindow to activeFactor times
+	// the min interval, 1ms by default.
+	activeFactor = 4
+)
+
+// SetPollInterval configures the shared input reader. Input is polled with the min interval
+// right after activity, then the interval doubles up to 4 times min for a second after the last
+// input, so the next note of a performance is read within about a millisecond. After that the
+// interval doubles up to max, which bounds the delay of the first event after a long pause and
+// keeps an idle input cheap. Use the same value for both to get a fixed interval, values <= 0
+// restore the defaults. Drivers that signal the arrival of input, such as VirtualDriver, wake
+// the reader without waiting for the next poll.
+func SetPollInterval(min, max time.Duration) {
+	if min <= 0 {
+		min = DefaultMinPollInterval
+	}
+	if max <= 0 {
+		max = DefaultMaxPollInterval
+	}
+	if max < min {
+		max = min
+	}
+	reader.mux.Lock()
+	reader.min, reader.max = min, max
+	reader.mux.Unlock()
+	reader.wake()
+}
+
+// notifier is implemented by driver streams that can signal the arrival of input.
+type notifier interface {
+	setNotify(fn func())
+}
+
+// inputReader is a single goroutine that reads all open input streams.
+type inputReader struct {
+	mux     sync.Mutex
+	streams []*InputStream
+	running bool
+	min     time.Duration
+	max     time.Duration
+	wakeC   chan struct{}
+}
+
+var reader = &inputReader{
+	min:   DefaultMinPollInterval,
+	max:   DefaultMaxPollInterval,
+	wakeC: make(chan struct{}, 1),
+}
+
+// add registers the stream and starts the reader goroutine if needed.
+func (r *inputReader) add(s *InputStream) {
+	if n, ok := s.stream.(notifier); ok {
+		n.setNotify(r.wake)
+		s.notifies = true
+	}
+	r.mux.Lock()
+	r.streams = append(r.streams, s)
+	if !r.running {
+		r.running = true
+		go r.run()
+	}
+	r.mux.Unlock()
+	r.wake()
+}
+
+// remove unregisters the stream, the stream is not accessed by the reader after it returns.
+func (r *inputReader) remove(s *InputStream) {
+	r.mux.Lock()
+	for i := range r.streams {
+		if r.streams[i] == s {
+			r.streams = append(r.streams[:i], r.streams[i+1:]...)
+			break
+		}
+	}
+	r.mux.Unlock()
+	r.wake()
+}
+
+func (r *inputReader) wake() {
+	select {
+	case r.wakeC <- struct{}{}:
+	default:
+	}
+}
+
+func (r *inputReader) run() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	var interval time.Duration
+	var lastInput time.Time
+	// handlers are the streams with events for the handler, see InputStream.dispatch.
+	var handlers []*InputStream
+	for {
+		var progress, pending, polling bool
+		r.mux.Lock()
+		if len(r.streams) == 0 {
+			r.running = false
+			r.mux.Unlock()
+			return
+		}
+		for _, s := range r.streams {
+			p, q := s.poll()
+			progress = progress || p
+			pending = pending || q
+			polling = polling || !s.notifies
+			if len(s.handling) > 0 {
+				handlers = append(handlers, s)
+			}
+		}
+		min, max := r.min, r.max
+		r.mux.Unlock()
+
+		for i, s := range handlers {
+			s.dispatch()
+			handlers[i] = nil
+		}
+		handlers = handlers[:0]
+
+		if progress {
+			interval = min
+			lastInput = time.Now()
+			continue
+		}
+		if ceiling := activeFactor * min; ceiling < max && time.Since(lastInput) < activeWindow {
+			max = ceiling
+		}
+		var timeout <-chan time.Time
+		if polling || pending {
+			if interval < min {
+				interval = min
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(interval)
+			timeout = timer.C
+		}
+		select {
+		case <-r.wakeC:
+			interval = min
+		case <-timeout:
+			if !pending {
+				interval *= 2
+				if interval > max {
+					interval = max
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package portmidi
+
+import (
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// pollingDriver hides the input notifications of a VirtualDriver,
+// so its streams are polled like PortMidi streams.
+type pollingDriver struct {
+	*VirtualDriver
+}
+
+func (d pollingDriver) OpenInput(id DeviceID, config StreamConfig) (DriverStream, error) {
+	stream, err := d.VirtualDriver.OpenInput(id, config)
+	if err != nil {
+		return nil, err
+	}
+	return struct{ DriverStream }{stream}, nil
+}
+
+// countingDriver hides the input notifications of a VirtualDriver like pollingDriver
+// and counts the driver calls made by the idle reader.
+type countingDriver struct {
+	*VirtualDriver
+	calls *int64
+}
+
+func (d countingDriver) OpenInput(id DeviceID, config StreamConfig) (DriverStream, error) {
+	stream, err := d.VirtualDriver.OpenInput(id, config)
+	if err != nil {
+		return nil, err
+	}
+	return countingStream{stream, d.calls}, nil
+}
+
+type countingStream struct {
+	DriverStream
+	calls *int64
+}
+
+func (s countingStream) Poll() (bool, error) {
+	atomic.AddInt64(s.calls, 1)
+	return s.DriverStream.Poll()
+}
+
+func (s countingStream) HasHostError() bool {
+	atomic.AddInt64(s.calls, 1)
+	return s.DriverStream.HasHostError()
+}
+
+// benchmarkIdleCalls measures the driver calls per second of an idle input, each of them
+// is a cgo call with PortMidi. The former per-stream goroutine polled 200 times a second.
+func benchmarkIdleCalls(b *testing.B, min, max time.Duration) {
+	var calls int64
+	drv := NewVirtualDriver()
+	SetDriver(countingDriver{drv, &calls})
+	defer SetDriver(nil)
+	if err := Initialize(); err != nil {
+		b.Fatal(err)
+	}
+	defer Terminate()
+	SetPollInterval(min, max)
+	defer SetPollInterval(0, 0)
+	inID := drv.AddInput("In")
+	in, err := OpenInput(inID)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer in.Close()
+	drv.Send(inID, Event{Message: NewMessage(0x90, 60, 100)})
+	<-in.Source()
+	time.Sleep(activeWindow + 100*time.Millisecond) // let the reader settle to idle
+
+	b.ResetTimer()
+	start, before := time.Now(), atomic.LoadInt64(&calls)
+	for i := 0; i < b.N; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	elapsed, n := time.Since(start), atomic.LoadInt64(&calls)-before
+	b.StopTimer()
+	b.ReportMetric(float64(n)/elapsed.Seconds(), "calls/s")
+}
+
+// BenchmarkIdleCallsFixedPoll reproduces the fixed 5ms poll delay of the former
+// per-stream input goroutines for comparison.
+func BenchmarkIdleCallsFixedPoll(b *testing.B) {
+	benchmarkIdleCalls(b, 5*time.Millisecond, 5*time.Millisecond)
+}
+
+func BenchmarkIdleCallsAdaptivePoll(b *testing.B) {
+	benchmarkIdleCalls(b, DefaultMinPollInterval, DefaultMaxPollInterval)
+}
+
+// benchmarkInputLatency measures the delay from sending an event after a short pause,
+// like the one between two notes, to reading it.
+func benchmarkInputLatency(b *testing.B, min, max time.Duration) {
+	drv := NewVirtualDriver()
+	SetDriver(pollingDriver{drv})
+	defer SetDriver(nil)
+	if err := Initialize(); err != nil {
+		b.Fatal(err)
+	}
+	defer Terminate()
+	SetPollInterval(min, max)
+	defer SetPollInterval(0, 0)
+	inID := drv.AddInput("In")
+	in, err := OpenInput(inID)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer in.Close()
+
+	delays := make([]time.Duration, 0, b.N)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		time.Sleep(10 * time.Millisecond) // let the reader back off
+		sent := time.Now()
+		drv.Send(inID, Event{Message: NewMessage(0x90, 60, 100)})
+		ev := <-in.Source()
+		delays = append(delays, ev.Arrival.Sub(sent))
+	}
+	b.StopTimer()
+	sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+	b.ReportMetric(float64(delays[len(delays)/2].Microseconds()), "p50-µs")
+	b.ReportMetric(float64(delays[len(delays)*99/100].Microseconds()), "p99-µs")
+	b.ReportMetric(float64(delays[len(delays)-1].Microseconds()), "max-µs")
+}
+
+// BenchmarkInputLatencyFixedPoll reproduces the fixed 5ms poll delay of the former
+// per-stream input goroutines for comparison.
+func BenchmarkInputLatencyFixedPoll(b *testing.B) {
+	benchmarkInputLatency(b, 5*time.Millisecond, 5*time.Millisecond)
+}
+
+func BenchmarkInputLatencyAdaptivePoll(b *testing.B) {
+	benchmarkInputLatency(b, DefaultMinPollInterval, DefaultMaxPollInterval)
+}
+
+func TestInputLatencyAfterPause(t *testing.T) {
+	drv := NewVirtualDriver()
+	useDriver(t, pollingDriver{drv})
+	inID := drv.AddInput("In")
+	in, err := OpenInput(inID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	var delays []time.Duration
+	for i := 0; i < 10; i++ {
+		time.Sleep(20 * time.Millisecond)
+		sent := time.Now()
+		drv.Send(inID, Event{Message: NewMessage(0x90, 60, 100)})
+		delays = append(delays, receive(t, in).Arrival.Sub(sent))
+	}
+	// the median rather than the worst delay, a loaded machine may delay any single event,
+	// still well below the former 5ms poll delay
+	want := activeFactor * DefaultMinPollInterval
+	sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+	if median := delays[len(delays)/2]; median > 3*want {
+		t.Errorf("median delay after a pause %v, want about %v", median, want)
+	}
+}
@@ -0,0 +1,286 @@
+package portmidi
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrDeviceRemoved is returned by the operations on a stream whose device
+// has disappeared after Rescan. The stream is reopened if the device comes back.
+var ErrDeviceRemoved = errors.New("portmidi: device removed")
+
+// reopener is a stream that can be reopened by Rescan.
+type reopener interface {
+	base() *baseStream
+	isInput() bool
+	// attach sets up a reopened driver stream, the stream mux is held.
+	attach(stream DriverStream) error
+}
+
+// openStreams tracks the open streams, mux is held while a stream is being opened
+// and during Rescan, so no stream is opened in the middle of the cycle.
+var openStreams struct {
+	mux  sync.Mutex
+	list []reopener
+}
+
+// track registers the stream, openStreams.mux must be held.
+func track(s reopener) {
+	openStreams.list = append(openStreams.list, s)
+}
+
+func untrack(s reopener) {
+	openStreams.mux.Lock()
+	defer openStreams.mux.Unlock()
+	for i := range openStreams.list {
+		if openStreams.list[i] == s {
+			openStreams.list = append(openStreams.list[:i], openStreams.list[i+1:]...)
+			return
+		}
+	}
+}
+
+// Rescan refreshes the list of devices, so the devices plugged in after Initialize appear
+// and the unplugged ones disappear. PortMidi enumerates devices only on initialization,
+// so Rescan closes the open streams, terminates and initializes the driver, then reopens
+// the streams with the same settings. Device IDs may change, streams follow their devices
+// and report the new ID, see Stream.DeviceID. Operations on a stream whose device is gone
+// fail with ErrDeviceRemoved until the device is back and a next Rescan reopens the stream.
+// Events in flight during the cycle may be lost, a SysEx message received in part is dropped.
+// The library must be initialized, see Initialize and Session.
+//
+// If the driver fails to terminate, the streams are reopened on the running driver and the
+// error is returned. If it fails to initialize again, the error is returned and the streams
+// fail with ErrDeviceRemoved until a next Rescan succeeds.
+func Rescan() error {
+	lib.mux.Lock()
+	defer lib.mux.Unlock()
+	if lib.refs == 0 {
+		return ErrNotInitialized
+	}
+	openStreams.mux.Lock()
+	defer openStreams.mux.Unlock()
+	defer reader.wake() // let input streams report the removed devices
+	streams := openStreams.list
+	for _, s := range streams {
+		b := s.base()
+		b.mux.Lock()
+		defer b.mux.Unlock()
+		if b.stream != nil {
+			b.stream.Close()
+			b.stream = detachedStream{ErrDeviceRemoved}
+		}
+	}
+	if !lib.failed {
+		if err := driver.Terminate(); err != nil {
+			reopen(streams)
+			return err
+		}
+	}
+	if err := driver.Initialize(); err != nil {
+		lib.failed = true
+		return err
+	}
+	lib.failed = false
+	reopen(streams)
+	return nil
+}
+
+// reopen opens the driver streams of the streams detached by Rescan,
+// the stream muxes are held.
+func reopen(streams []reopener) {
+	for _, s := range streams {
+		b := s.base()
+		if b.stream == nil { // closed
+			continue
+		}
+		id, err := b.key.resolve(s.isInput())
+		if err != nil {
+			continue
+		}
+		var stream DriverStream
+		if s.isInput() {
+			stream, err = driver.OpenInput(id, b.config)
+		} else {
+			stream, err = driver.OpenOutput(id, b.config)
+		}
+		if err != nil {
+			b.stream = detachedStream{err}
+			continue
+		}
+		b.id = id
+		b.stream = stream
+		if err := s.attach(stream); err != nil {
+			b.stream = detachedStream{err}
+			stream.Close()
+		}
+	}
+}
+
+// detachedStream stands for the driver stream of a removed device.
+type detachedStream struct {
+	err error
+}
+
+func (d detachedStream) Poll() (bool, error)                 { return false, d.err }
+func (d detachedStream) Read([]Event) (int, error)           { return 0, d.err }
+func (d detachedStream) Write([]Event) error                 { return d.err }
+func (d detachedStream) WriteShort(Timestamp, Message) error { return d.err }
+func (d detachedStream) WriteSysEx(Timestamp, []byte) error  { return d.err }
+func (d detachedStream) SetFilter(Filter) error              { return d.err }
+func (d detachedStream) SetChannelMask(ChannelMask) error    { return d.err }
+func (d detachedStream) HasHostError() bool                  { return false }
+func (d detachedStream) Abort() error                        { return nil }
+func (d detachedStream) Synchronize() error                  { return d.err }
+func (d detachedStream) Close() error                        { return nil }
+
+// DeviceEventType is the kind of a device change.
+type DeviceEventType int
+
+const (
+	// DeviceAdded means a device has appeared.
+	DeviceAdded DeviceEventType = iota
+	// DeviceRemoved means a device has disappeared, Device holds its last known description.
+	DeviceRemoved
+)
+
+func (t DeviceEventType) String() string {
+	switch t {
+	case DeviceAdded:
+		return "added"
+	case DeviceRemoved:
+		return "removed"
+	}
+	return "unknown"
+}
+
+// DeviceEvent reports a device change found by WatchDevices.
+type DeviceEvent struct {
+	Type   DeviceEventType
+	Device Device
+}
+
+// watch holds the settings of WatchDevices.
+var watch struct {
+	mux            sync.Mutex
+	rescanInterval time.Duration
+}
+
+// SetOpenRescanInterval makes WatchDevices call Rescan at least every d while streams are open,
+// even though the driver reports no change. PortMidi enumerates devices only on initialization,
+// so this is the only way for WatchDevices to notice the devices plugged or unplugged while
+// streams are open. Each such Rescan reopens the open streams, see Rescan for the events that
+// may be lost, so d should be long compared to the watch interval, e.g. 30 seconds.
+// Values <= 0 restore the default: no rescan while streams are open unless the driver reports
+// a change, so with PortMidi the changes are noticed only after the streams are closed or after
+// an explicit Rescan.
+func SetOpenRescanInterval(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	watch.mux.Lock()
+	watch.rescanInterval = d
+	watch.mux.Unlock()
+}
+
+// WatchDevices checks the devices every interval and reports the devices that have been added
+// or removed since the previous check. The channel is closed when ctx is done. While no streams
+// are open, every check calls Rescan. While streams are open, Rescan is called only when the
+// driver reports a different list of devices, so the streams are not reopened on every tick.
+// PortMidi never reports a different list before Rescan, so by default the devices changed
+// while streams are open are not noticed until the streams are closed, see SetOpenRescanInterval
+// to rescan periodically. Failed rescans are retried on the next tick.
+func WatchDevices(ctx context.Context, interval time.Duration) <-chan DeviceEvent {
+	events := make(chan DeviceEvent)
+	known := snapshotDevices()
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		lastRescan := time.Now()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			watch.mux.Lock()
+			rescanInterval := watch.rescanInterval
+			watch.mux.Unlock()
+			due := rescanInterval > 0 && time.Since(lastRescan) >= rescanInterval
+			if due || needsRescan(known) {
+				if err := Rescan(); err != nil {
+					continue
+				}
+				lastRescan = time.Now()
+			}
+			current := snapshotDevices()
+			var changes []DeviceEvent
+			for k, d := range current {
+				if _, ok := known[k]; !ok {
+					changes = append(changes, DeviceEvent{Type: DeviceAdded, Device: d})
+				}
+			}
+			for k, d := range known {
+				if _, ok := current[k]; !ok {
+					changes = append(changes, DeviceEvent{Type: DeviceRemoved, Device: d})
+				}
+			}
+			known = current
+			sort.Slice(changes, func(i, j int) bool {
+				if changes[i].Type != changes[j].Type {
+					return changes[i].Type > changes[j].Type // removed first
+				}
+				return changes[i].Device.ID < changes[j].Device.ID
+			})
+			for _, ev := range changes {
+				select {
+				case events <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events
+}
+
+type watchKey struct {
+	key   DeviceKey
+	input bool
+}
+
+func snapshotDevices() map[watchKey]Device {
+	devices := make(map[watchKey]Device)
+	for _, d := range Devices() {
+		devices[watchKey{d.Key, d.IsInputAvailable}] = d
+	}
+	return devices
+}
+
+// needsRescan reports whether WatchDevices should call Rescan: no streams are open,
+// the last Rescan has failed or the driver lists other devices than known.
+func needsRescan(known map[watchKey]Device) bool {
+	lib.mux.Lock()
+	failed := lib.failed
+	lib.mux.Unlock()
+	openStreams.mux.Lock()
+	n := len(openStreams.list)
+	openStreams.mux.Unlock()
+	if failed || n == 0 {
+		return true
+	}
+	current := snapshotDevices()
+	if len(current) != len(known) {
+		return true
+	}
+	for k := range current {
+		if _, ok := known[k]; !ok {
+			return true
+		}
+	}
+	return false
+}
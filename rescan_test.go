@@ -0,0 +1,202 @@
+package portmidi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errDriver = errors.New("driver failure")
+
+// flakyDriver is a VirtualDriver whose Terminate and Initialize can be made to fail.
+type flakyDriver struct {
+	*VirtualDriver
+	failTerminate  int32
+	failInitialize int32
+	inits          int32
+}
+
+func (d *flakyDriver) Initialize() error {
+	atomic.AddInt32(&d.inits, 1)
+	if atomic.LoadInt32(&d.failInitialize) != 0 {
+		return errDriver
+	}
+	return nil
+}
+
+func (d *flakyDriver) Terminate() error {
+	if atomic.LoadInt32(&d.failTerminate) != 0 {
+		return errDriver
+	}
+	return nil
+}
+
+func useFlakyDriver(tb testing.TB) *flakyDriver {
+	drv := &flakyDriver{VirtualDriver: NewVirtualDriver()}
+	useDriver(tb, drv)
+	atomic.StoreInt32(&drv.inits, 0)
+	return drv
+}
+
+// checkLoopback fails the test unless a note written to out is received by in,
+// the input may report that the device has been removed during a failed rescan.
+func checkLoopback(tb testing.TB, out *OutputStream, in *InputStream) {
+	tb.Helper()
+	note := NewMessage(0x90, 60, 100)
+	if err := out.Write(context.Background(), Event{Message: note}); err != nil {
+		tb.Fatal(err)
+	}
+	ev := receive(tb, in)
+	for ev.Err != nil && errors.Is(ev.Err, ErrDeviceRemoved) {
+		ev = receive(tb, in)
+	}
+	if ev.Message != note || ev.Err != nil {
+		tb.Fatalf("got %v, want note %v", ev, note)
+	}
+}
+
+func TestRescanTerminateError(t *testing.T) {
+	drv := useFlakyDriver(t)
+	out, in := openLoopback(t, drv.VirtualDriver)
+	defer in.Close()
+	defer out.Close()
+
+	atomic.StoreInt32(&drv.failTerminate, 1)
+	if err := Rescan(); err != errDriver {
+		t.Fatalf("got %v, want the driver error", err)
+	}
+	atomic.StoreInt32(&drv.failTerminate, 0)
+	checkLoopback(t, out, in)
+}
+
+func TestRescanInitializeError(t *testing.T) {
+	drv := useFlakyDriver(t)
+	out, in := openLoopback(t, drv.VirtualDriver)
+	defer in.Close()
+	defer out.Close()
+
+	atomic.StoreInt32(&drv.failInitialize, 1)
+	if err := Rescan(); err != errDriver {
+		t.Fatalf("got %v, want the driver error", err)
+	}
+	err := out.Write(context.Background(), Event{Message: NewMessage(0x90, 60, 100)})
+	if !errors.Is(err, ErrDeviceRemoved) {
+		t.Errorf("write after a failed rescan: got %v, want ErrDeviceRemoved", err)
+	}
+	atomic.StoreInt32(&drv.failInitialize, 0)
+	if err := Rescan(); err != nil {
+		t.Fatal(err)
+	}
+	checkLoopback(t, out, in)
+}
+
+func TestRescanDropsPartialSysEx(t *testing.T) {
+	drv := useVirtualDriver(t)
+	inID := drv.AddInput("In")
+	in, err := OpenInput(inID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	clock := NewMessage(0xF8, 0, 0)
+	drv.Send(inID,
+		Event{Message: Message(0x030201F0)}, // SysEx without the end
+		Event{Message: clock},
+	)
+	if ev := receive(t, in); ev.Message != clock {
+		t.Fatalf("got %v, want clock", ev)
+	}
+	if err := Rescan(); err != nil {
+		t.Fatal(err)
+	}
+	sysEx := []byte{0xF0, 0x7E, 0x7F, 0x06, 0x01, 0xF7}
+	drv.Send(inID, Event{SysExData: sysEx})
+	if ev := receive(t, in); !bytes.Equal(ev.SysExData, sysEx) || ev.Err != nil {
+		t.Errorf("got %v, want SysEx % X", ev, sysEx)
+	}
+}
+
+func TestWatchDevicesOpenStreams(t *testing.T) {
+	drv := useFlakyDriver(t)
+	out, in := openLoopback(t, drv.VirtualDriver)
+	defer in.Close()
+	defer out.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := WatchDevices(ctx, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if n := atomic.LoadInt32(&drv.inits); n != 0 {
+		t.Errorf("rescanned %d times with no device change", n)
+	}
+	drv.AddInput("New")
+	select {
+	case ev := <-events:
+		if ev.Type != DeviceAdded || ev.Device.Name != "New" {
+			t.Errorf("got %v, want the new device added", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no device event")
+	}
+	if atomic.LoadInt32(&drv.inits) == 0 {
+		t.Error("not rescanned after a device change")
+	}
+	checkLoopback(t, out, in)
+}
+
+// enumeratingDriver lists the devices known on Initialize, like PortMidi,
+// the devices added to the VirtualDriver later appear after a Rescan.
+type enumeratingDriver struct {
+	*VirtualDriver
+	count int32
+}
+
+func (d *enumeratingDriver) Initialize() error {
+	atomic.StoreInt32(&d.count, int32(d.VirtualDriver.CountDevices()))
+	return nil
+}
+
+func (d *enumeratingDriver) CountDevices() int {
+	return int(atomic.LoadInt32(&d.count))
+}
+
+func TestWatchDevicesEnumeratingDriver(t *testing.T) {
+	drv := &enumeratingDriver{VirtualDriver: NewVirtualDriver()}
+	outID, inID := drv.AddLoopback("Loop")
+	useDriver(t, drv)
+	in, err := OpenInput(inID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	out, err := OpenOutput(outID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	defer SetOpenRescanInterval(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := WatchDevices(ctx, time.Millisecond)
+	drv.AddInput("New")
+	select {
+	case ev := <-events:
+		t.Fatalf("got %v without a rescan", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+	SetOpenRescanInterval(20 * time.Millisecond)
+	select {
+	case ev := <-events:
+		if ev.Type != DeviceAdded || ev.Device.Name != "New" {
+			t.Errorf("got %v, want the new device added", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no device event")
+	}
+	checkLoopback(t, out, in)
+}
@@ -0,0 +1,205 @@
+package portmidi
+
+import (
+	"container/heap"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// LateError reports an event that the scheduler of an output stream has sent later
+// than its time by more than the tolerance, see WithScheduler. The event has been sent.
+type LateError struct {
+	// Delay is the time from the scheduled time of the event to the moment it has been sent.
+	Delay time.Duration
+}
+
+func (e *LateError) Error() string {
+	return fmt.Sprintf("portmidi: event sent %v late", e.Delay)
+}
+
+// WithScheduler makes an output stream schedule the events written into Sink itself instead
+// of relying on the timing of the host driver: the events are held in a queue and sent at
+// their timestamp plus the latency, see WithLatency, so timing is the same on every backend.
+// A zero timestamp means the time the event has been received from Sink. Zero is also a valid
+// time of the stream clock, e.g. the first millisecond of a GoClock or the moment the clock
+// wraps around, see Timestamp, so an event due at that very time is sent as soon as it is
+// received, give it the next millisecond instead. Real-time messages, e.g. clock, are sent
+// ahead of the other events that are due by then, so a burst of late events does not delay
+// them. They are not sent in the middle of another message though: a SysEx message sent in
+// chunks, see WithSysExChunks, holds the output, real-time messages included, until its last
+// chunk. Events sent later than their time by more than tolerance are reported with LateError
+// on Errors and counted in Stats. Write bypasses the scheduler. Close waits until all the
+// scheduled events are sent, even those scheduled far in the future, use CloseContext to
+// bound the wait and drop the rest. Output only.
+func WithScheduler(tolerance time.Duration) Option {
+	return func(c *config) error {
+		if tolerance < 0 {
+			return fmt.Errorf("%w: scheduler tolerance %v", ErrInvalidOption, tolerance)
+		}
+		c.scheduler = true
+		c.tolerance = tolerance
+		c.outputOnly = append(c.outputOnly, "scheduler")
+		return nil
+	}
+}
+
+// scheduledEvent is an event waiting in the scheduler queue.
+type scheduledEvent struct {
+	ev  Event
+	due Timestamp
+	// seq keeps the order of the events due at the same time.
+	seq uint64
+}
+
+// eventQueue is a priority queue of the scheduled events ordered by the time they are due.
+type eventQueue []scheduledEvent
+
+func (q eventQueue) Len() int { return len(q) }
+
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].due != q[j].due {
+		return q[i].due.Before(q[j].due)
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q eventQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *eventQueue) Push(x interface{}) {
+	*q = append(*q, x.(scheduledEvent))
+}
+
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	n := len(old) - 1
+	ev := old[n]
+	old[n] = scheduledEvent{}
+	*q = old[:n]
+	return ev
+}
+
+// isRealTime reports whether ev is a system real-time message.
+func isRealTime(ev *Event) bool {
+	return len(ev.SysExData) == 0 && ev.Message.Status() >= 0xF8
+}
+
+// schedule queues ev to be sent at its timestamp plus the latency.
+func (s *OutputStream) schedule(ev Event) {
+	due := ev.Timestamp
+	if due == 0 {
+		due = s.clock.Now()
+	}
+	s.seq++
+	heap.Push(&s.queue, scheduledEvent{
+		ev:  ev,
+		due: due.Add(s.latency),
+		seq: s.seq,
+	})
+	atomic.AddInt64(&s.queued, 1)
+}
+
+// dispatch sends the events that are due, real-time messages first, and reports
+// the late ones. It returns the time until the next event is due, or false if
+// the queue is empty.
+func (s *OutputStream) dispatch(batch []Event) ([]Event, time.Duration, bool) {
+	if s.isAborted() {
+		atomic.AddUint64(&s.stats.dropped, uint64(len(s.queue)))
+		atomic.AddInt64(&s.queued, -int64(len(s.queue)))
+		s.queue = s.queue[:0]
+		return batch, 0, false
+	}
+	now := s.clock.Now()
+	batch = batch[:0]
+	split := 0
+	for len(s.queue) > 0 && !now.Before(s.queue[0].due) {
+		e := heap.Pop(&s.queue).(scheduledEvent)
+		if delay := now.Sub(e.due); delay > s.tolerance {
+			atomic.AddUint64(&s.stats.late, 1)
+			s.reportLate(e.ev, delay)
+		}
+		batch = append(batch, e.ev)
+		if isRealTime(&e.ev) {
+			// move the real-time message ahead of the other events
+			copy(batch[split+1:], batch[split:len(batch)-1])
+			batch[split] = e.ev
+			split++
+		}
+	}
+	atomic.AddInt64(&s.queued, -int64(len(batch)))
+	size := int(atomic.LoadInt32(&s.batchSize))
+	for b := batch; len(b) > 0; {
+		n := len(b)
+		if n > size {
+			n = size
+		}
+		s.writeBatch(b[:n])
+		b = b[n:]
+	}
+	if len(s.queue) == 0 {
+		return batch, 0, false
+	}
+	return batch, s.queue[0].due.Sub(now), true
+}
+
+// reportLate reports a late event on Errors without blocking.
+func (s *OutputStream) reportLate(ev Event, delay time.Duration) {
+	select {
+	case s.errC <- &WriteError{
+		Event: ev,
+		Batch: []Event{ev},
+		Err:   &LateError{Delay: delay},
+	}:
+	default:
+	}
+}
+
+// processScheduled is the output loop of a stream with a scheduler, it queues the events
+// written into Sink and sends them when they are due.
+func (s *OutputStream) processScheduled() {
+	defer close(s.doneC)
+	defer close(s.errC)
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	in, closeC := s.buf, s.closeC
+	var batch []Event
+	for {
+		var wait time.Duration
+		var pending bool
+		batch, wait, pending = s.dispatch(batch)
+		if !pending && in == nil { // closed and sent
+			return
+		}
+		var deadline <-chan time.Time
+		if pending {
+			timer.Reset(wait)
+			deadline = timer.C
+		}
+		select {
+		case <-closeC:
+			// schedule the events queued at the moment of the call
+		loop:
+			for n := len(s.buf); n > 0; n-- {
+				select {
+				case ev := <-s.buf:
+					s.schedule(ev)
+				default:
+					break loop
+				}
+			}
+			s.dropQueued() // written after Close
+			in, closeC = nil, nil
+		case ev, ok := <-in:
+			if !ok { // s.buf closed
+				return
+			}
+			s.schedule(ev)
+		case <-deadline:
+			deadline = nil
+		case <-s.wake:
+		}
+		if deadline != nil && !timer.Stop() {
+			<-timer.C
+		}
+	}
+}
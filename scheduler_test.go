@@ -0,0 +1,87 @@
+package portmidi
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// openScheduledLoopback opens a loopback whose output has a scheduler,
+// both streams use clock.
+func openScheduledLoopback(tb testing.TB, drv *VirtualDriver, clock Clock, tolerance time.Duration) (*OutputStream, *InputStream) {
+	tb.Helper()
+	outID, inID := drv.AddLoopback("Loop")
+	in, err := OpenInput(inID, WithClock(clock))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	out, err := OpenOutput(outID, WithClock(clock), WithScheduler(tolerance))
+	if err != nil {
+		in.Close()
+		tb.Fatal(err)
+	}
+	return out, in
+}
+
+func TestSchedulerOrder(t *testing.T) {
+	drv := useVirtualDriver(t)
+	clock := NewGoClock()
+	out, in := openScheduledLoopback(t, drv, clock, time.Second)
+	defer in.Close()
+	defer out.Close()
+
+	now := clock.Now() + 1 // not zero
+	var (
+		first  = Event{Timestamp: now.Add(50 * time.Millisecond), Message: NewMessage(0x90, 60, 100)}
+		second = Event{Timestamp: now.Add(100 * time.Millisecond), Message: NewMessage(0x90, 62, 100)}
+		tick   = Event{Timestamp: second.Timestamp, Message: NewMessage(0xF8, 0, 0)}
+		third  = Event{Timestamp: now.Add(150 * time.Millisecond), Message: NewMessage(0x90, 64, 100)}
+	)
+	for _, ev := range []Event{third, second, tick, first} {
+		out.Sink() <- ev
+	}
+	for _, want := range []Event{first, tick, second, third} {
+		ev := receive(t, in)
+		if ev.Message != want.Message {
+			t.Fatalf("got %v, want %v", ev.Message, want.Message)
+		}
+		if ev.Timestamp.Before(want.Timestamp) {
+			t.Errorf("%v: received at %d, before it is due at %d", ev.Message, ev.Timestamp, want.Timestamp)
+		}
+	}
+	if st := out.Stats(); st.Late != 0 || st.Events != 4 {
+		t.Errorf("got %+v, want 4 events sent in time", st)
+	}
+}
+
+func TestSchedulerLate(t *testing.T) {
+	drv := useVirtualDriver(t)
+	clock := NewGoClock()
+	out, in := openScheduledLoopback(t, drv, clock, 5*time.Millisecond)
+	defer in.Close()
+	defer out.Close()
+
+	late := Event{Timestamp: clock.Now() - 50, Message: NewMessage(0x90, 60, 100)}
+	out.Sink() <- late
+	if ev := receive(t, in); ev.Message != late.Message {
+		t.Fatalf("got %v, want the late note", ev)
+	}
+	select {
+	case werr := <-out.Errors():
+		var lateErr *LateError
+		if !errors.As(werr, &lateErr) {
+			t.Fatalf("got %v, want LateError", werr)
+		}
+		if lateErr.Delay < 50*time.Millisecond {
+			t.Errorf("got delay %v, want at least 50ms", lateErr.Delay)
+		}
+		if werr.Event.Message != late.Message {
+			t.Errorf("got late event %v, want %v", werr.Event, late)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no late error reported")
+	}
+	if st := out.Stats(); st.Late != 1 {
+		t.Errorf("got %d late events, want 1", st.Late)
+	}
+}
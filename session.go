@@ -0,0 +1,190 @@
+package portmidi
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrNotInitialized is returned by Terminate, Rescan and the functions opening streams
+	// when the library has not been initialized.
+	ErrNotInitialized = errors.New("portmidi: not initialized")
+	// ErrStreamsOpen is returned when terminating the library while streams are still open.
+	ErrStreamsOpen = errors.New("portmidi: streams are still open")
+	// ErrTerminated is returned by the methods of a terminated Session.
+	ErrTerminated = errors.New("portmidi: session terminated")
+)
+
+// lib counts the references to the initialized driver, see Session.
+var lib struct {
+	mux  sync.Mutex
+	refs int
+	// failed is set when Rescan could not initialize the driver again,
+	// the driver is terminated until a next Rescan succeeds.
+	failed bool
+}
+
+// initialized reports whether the library is initialized.
+func initialized() bool {
+	lib.mux.Lock()
+	defer lib.mux.Unlock()
+	return lib.refs > 0
+}
+
+// acquire initializes the driver on the first reference.
+func acquire() error {
+	lib.mux.Lock()
+	defer lib.mux.Unlock()
+	if lib.refs == 0 {
+		if err := driver.Initialize(); err != nil {
+			return err
+		}
+	}
+	lib.refs++
+	return nil
+}
+
+// release terminates the driver when the last reference is released, unless streams are open.
+func release() error {
+	lib.mux.Lock()
+	defer lib.mux.Unlock()
+	if lib.refs == 0 {
+		return ErrNotInitialized
+	}
+	if lib.refs == 1 {
+		openStreams.mux.Lock()
+		n := len(openStreams.list)
+		openStreams.mux.Unlock()
+		if n > 0 {
+			return ErrStreamsOpen
+		}
+		if !lib.failed {
+			if err := driver.Terminate(); err != nil {
+				return err
+			}
+		}
+		lib.failed = false
+	}
+	lib.refs--
+	return nil
+}
+
+// Session is a reference to the initialized library. The library is initialized by the first
+// session and terminated with the last one, so independent packages in one program can use
+// PortMidi without breaking each other. Streams opened through a session belong to it.
+// Initialize and Terminate hold a reference as well, as if they created and terminated a session.
+type Session struct {
+	mux        sync.Mutex
+	terminated bool
+	streams    []Stream
+}
+
+// NewSession initializes the library unless it is initialized already.
+func NewSession() (*Session, error) {
+	if err := acquire(); err != nil {
+		return nil, err
+	}
+	return &Session{}, nil
+}
+
+// Open opens device with the options like the package-level Open, the stream belongs to the session.
+func (s *Session) Open(id DeviceID, opts ...Option) (Stream, error) {
+	return s.open(func() (Stream, error) {
+		return Open(id, opts...)
+	})
+}
+
+// OpenInput opens device for the input like the package-level OpenInput,
+// the stream belongs to the session.
+func (s *Session) OpenInput(id DeviceID, opts ...Option) (*InputStream, error) {
+	stream, err := s.open(func() (Stream, error) {
+		return OpenInput(id, opts...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stream.(*InputStream), nil
+}
+
+// OpenOutput opens device for the output like the package-level OpenOutput,
+// the stream belongs to the session.
+func (s *Session) OpenOutput(id DeviceID, opts ...Option) (*OutputStream, error) {
+	stream, err := s.open(func() (Stream, error) {
+		return OpenOutput(id, opts...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stream.(*OutputStream), nil
+}
+
+func (s *Session) open(fn func() (Stream, error)) (Stream, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.terminated {
+		return nil, ErrTerminated
+	}
+	stream, err := fn()
+	if err != nil {
+		return nil, err
+	}
+	stream.(reopener).base().session = s
+	s.streams = append(s.streams, stream)
+	return stream, nil
+}
+
+// forget removes a closed stream from the session.
+func (s *Session) forget(stream Stream) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for i := range s.streams {
+		if s.streams[i] == stream {
+			s.streams = append(s.streams[:i], s.streams[i+1:]...)
+			return
+		}
+	}
+}
+
+// Devices returns all the devices known to the driver, see the package-level Devices.
+func (s *Session) Devices() ([]Device, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.terminated {
+		return nil, ErrTerminated
+	}
+	return Devices(), nil
+}
+
+// Streams returns the open streams of the session.
+func (s *Session) Streams() []Stream {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return append([]Stream(nil), s.streams...)
+}
+
+// Terminate releases the session, the library is terminated if this is the last reference.
+// It fails with ErrStreamsOpen while the streams of the session are open, or, for the last
+// reference, any streams are open. Subsequent calls return ErrTerminated.
+func (s *Session) Terminate() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.terminated {
+		return ErrTerminated
+	}
+	if len(s.streams) > 0 {
+		return ErrStreamsOpen
+	}
+	if err := release(); err != nil {
+		return err
+	}
+	s.terminated = true
+	return nil
+}
+
+// Close closes the open streams of the session and terminates it.
+func (s *Session) Close() error {
+	for _, stream := range s.Streams() {
+		stream.Close()
+	}
+	return s.Terminate()
+}
@@ -0,0 +1,156 @@
+package portmidi
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestNotInitialized(t *testing.T) {
+	drv := NewVirtualDriver()
+	outID, inID := drv.AddLoopback("Loop")
+	SetDriver(drv)
+	defer SetDriver(nil)
+
+	check := func(when string) {
+		t.Helper()
+		if _, err := OpenInput(inID); err != ErrNotInitialized {
+			t.Errorf("%s: OpenInput: got %v, want ErrNotInitialized", when, err)
+		}
+		if _, err := OpenOutput(outID); err != ErrNotInitialized {
+			t.Errorf("%s: OpenOutput: got %v, want ErrNotInitialized", when, err)
+		}
+		if _, err := Open(inID); err != ErrNotInitialized {
+			t.Errorf("%s: Open: got %v, want ErrNotInitialized", when, err)
+		}
+		if n := CountDevices(); n != 0 {
+			t.Errorf("%s: CountDevices: got %d, want 0", when, n)
+		}
+		if info := GetDeviceInfo(inID); info != nil {
+			t.Errorf("%s: GetDeviceInfo: got %+v, want nil", when, info)
+		}
+		if _, ok := DefaultInputDeviceID(); ok {
+			t.Errorf("%s: DefaultInputDeviceID: got a device", when)
+		}
+		if devices := Devices(); len(devices) != 0 {
+			t.Errorf("%s: Devices: got %v, want none", when, devices)
+		}
+		if _, err := KeyOf(inID); err != ErrNotInitialized {
+			t.Errorf("%s: KeyOf: got %v, want ErrNotInitialized", when, err)
+		}
+		if _, err := (DeviceKey{Interface: VirtualInterface, Name: "Loop"}).ResolveInput(); err != ErrNotInitialized {
+			t.Errorf("%s: ResolveInput: got %v, want ErrNotInitialized", when, err)
+		}
+	}
+	check("before Initialize")
+
+	if err := Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if n := CountDevices(); n != 2 {
+		t.Errorf("got %d devices, want 2", n)
+	}
+	in, err := OpenInput(inID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := Terminate(); err != nil {
+		t.Fatal(err)
+	}
+	check("after Terminate")
+}
+
+func TestSessionRefs(t *testing.T) {
+	drv := &flakyDriver{VirtualDriver: NewVirtualDriver()}
+	inID := drv.AddInput("In")
+	SetDriver(drv)
+	defer SetDriver(nil)
+
+	first, err := NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&drv.inits); n != 1 {
+		t.Errorf("initialized %d times, want once", n)
+	}
+	if err := first.Terminate(); err != nil {
+		t.Fatal(err)
+	}
+	if !initialized() {
+		t.Fatal("terminated with a session left")
+	}
+	if err := second.Terminate(); err != nil {
+		t.Fatal(err)
+	}
+	if initialized() {
+		t.Fatal("not terminated with the last session")
+	}
+
+	if err := first.Terminate(); err != ErrTerminated {
+		t.Errorf("Terminate: got %v, want ErrTerminated", err)
+	}
+	if _, err := first.OpenInput(inID); err != ErrTerminated {
+		t.Errorf("OpenInput: got %v, want ErrTerminated", err)
+	}
+	if _, err := first.Devices(); err != ErrTerminated {
+		t.Errorf("Devices: got %v, want ErrTerminated", err)
+	}
+	if err := first.Close(); err != ErrTerminated {
+		t.Errorf("Close: got %v, want ErrTerminated", err)
+	}
+}
+
+func TestSessionStreams(t *testing.T) {
+	drv := NewVirtualDriver()
+	outID, inID := drv.AddLoopback("Loop")
+	SetDriver(drv)
+	defer SetDriver(nil)
+
+	s, err := NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := s.OpenInput(inID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := s.Open(outID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.Streams()); n != 2 {
+		t.Errorf("got %d streams, want 2", n)
+	}
+	if err := s.Terminate(); err != ErrStreamsOpen {
+		t.Errorf("Terminate with open streams: got %v, want ErrStreamsOpen", err)
+	}
+	if err := other.Terminate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if streams := s.Streams(); len(streams) != 1 || streams[0] != in {
+		t.Errorf("got streams %v, want the input", streams)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.SetFilter(FilterClock); err != ErrClosed {
+		t.Errorf("input after Close: got %v, want ErrClosed", err)
+	}
+	if initialized() {
+		t.Error("not terminated with the last session")
+	}
+}
@@ -0,0 +1,133 @@
+package portmidi
+
+import (
+	"expvar"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the counters of a stream.
+type Stats struct {
+	// Events is the number of events received from the input, or written to the output.
+	Events uint64
+	// SysExBytes is the number of bytes in the received or written SysEx messages.
+	SysExBytes uint64
+	// Dropped is the number of events dropped under the backpressure policy of an input,
+	// or discarded by an output that has been aborted or stopped after an error.
+	Dropped uint64
+	// Overflows is the number of times the input buffer has overflowed.
+	Overflows uint64
+	// WriteErrors is the number of failed writes to an output.
+	WriteErrors uint64
+	// Late is the number of events sent late by the scheduler of an output, see WithScheduler.
+	Late uint64
+	// QueueDepth is the number of events waiting in Source or Sink.
+	QueueDepth int
+	// Delay is the spread of the input delay, the time from the event timestamp
+	// to the moment the event has been read from the driver.
+	Delay DelayStats
+}
+
+// DelayStats describes the spread of the input delay.
+type DelayStats struct {
+	Count uint64
+	Min   time.Duration
+	Max   time.Duration
+	Mean  time.Duration
+}
+
+// counters are the stream statistics updated with atomic operations, all the fields
+// are 64-bit, so they are aligned as long as the counters are.
+type counters struct {
+	events      uint64
+	sysExBytes  uint64
+	dropped     uint64
+	overflows   uint64
+	writeErrors uint64
+	late        uint64
+
+	// delays are in milliseconds.
+	delayCount uint64
+	delaySum   int64
+	delayMin   int64
+	delayMax   int64
+}
+
+func newCounters() counters {
+	return counters{
+		delayMin: math.MaxInt64,
+		delayMax: math.MinInt64,
+	}
+}
+
+// count adds an event to the counters.
+func (c *counters) count(ev *Event) {
+	atomic.AddUint64(&c.events, 1)
+	if n := len(ev.SysExData); n > 0 {
+		atomic.AddUint64(&c.sysExBytes, uint64(n))
+	}
+}
+
+// delay adds the input delay of an event read at now, in milliseconds.
+func (c *counters) delay(now, timestamp Timestamp) {
+	d := int64(now.Sub(timestamp) / time.Millisecond)
+	atomic.AddUint64(&c.delayCount, 1)
+	atomic.AddInt64(&c.delaySum, d)
+	for min := atomic.LoadInt64(&c.delayMin); d < min; min = atomic.LoadInt64(&c.delayMin) {
+		if atomic.CompareAndSwapInt64(&c.delayMin, min, d) {
+			break
+		}
+	}
+	for max := atomic.LoadInt64(&c.delayMax); d > max; max = atomic.LoadInt64(&c.delayMax) {
+		if atomic.CompareAndSwapInt64(&c.delayMax, max, d) {
+			break
+		}
+	}
+}
+
+func (c *counters) snapshot(queueDepth int) Stats {
+	st := Stats{
+		Events:      atomic.LoadUint64(&c.events),
+		SysExBytes:  atomic.LoadUint64(&c.sysExBytes),
+		Dropped:     atomic.LoadUint64(&c.dropped),
+		Overflows:   atomic.LoadUint64(&c.overflows),
+		WriteErrors: atomic.LoadUint64(&c.writeErrors),
+		Late:        atomic.LoadUint64(&c.late),
+		QueueDepth:  queueDepth,
+	}
+	if n := atomic.LoadUint64(&c.delayCount); n > 0 {
+		st.Delay = DelayStats{
+			Count: n,
+			Min:   time.Duration(atomic.LoadInt64(&c.delayMin)) * time.Millisecond,
+			Max:   time.Duration(atomic.LoadInt64(&c.delayMax)) * time.Millisecond,
+			Mean:  time.Duration(atomic.LoadInt64(&c.delaySum)) * time.Millisecond / time.Duration(n),
+		}
+	}
+	return st
+}
+
+// PublishStats publishes the statistics of all open streams as an expvar variable with
+// the given name, a map from "in " or "out " followed by the device key to Stats.
+// Like expvar.Publish, it panics if the name is already in use.
+func PublishStats(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		openStreams.mux.Lock()
+		streams := append([]reopener(nil), openStreams.list...)
+		openStreams.mux.Unlock()
+		stats := make(map[string]Stats, len(streams))
+		for _, s := range streams {
+			b := s.base()
+			b.mux.Lock()
+			key := b.key.String()
+			b.mux.Unlock()
+			if s.isInput() {
+				key = "in " + key
+			} else {
+				key = "out " + key
+			}
+			stats[key] = s.(Stream).Stats()
+		}
+		return stats
+	}))
+}
@@ -1,176 +1,83 @@
 package portmidi
 
 import (
+	"errors"
+	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/xlab/portmidi/pm"
 )
 
-type Stream struct {
-	stream *pm.PortMidiStream
-	buf    chan Event
-	closeC chan struct{}
-	doneC  chan struct{}
-}
-
-// Close closes a midi stream, flushing any pending buffers.
-func (s *Stream) Close() error {
-	close(s.closeC)
-	<-s.doneC
-	err := pm.ToError(pm.Close(s.stream))
-	s.stream = nil
-	return err
-}
-
-func (s *Stream) Source() <-chan Event {
-	return s.buf
-}
+// ErrClosed is returned by the operations on a closed stream.
+var ErrClosed = errors.New("portmidi: stream closed")
 
-func (s *Stream) Sink() chan<- Event {
-	return s.buf
+// Stream is the behavior shared by InputStream and OutputStream.
+type Stream interface {
+	// Close closes a midi stream, flushing any pending buffers.
+	Close() error
+	// HasHostError tests whether stream has a pending host error.
+	HasHostError() bool
+	// DeviceID returns the ID of the device, it may change after Rescan.
+	DeviceID() DeviceID
+	// Stats returns the statistics of the stream.
+	Stats() Stats
+	// Time converts a timestamp of the stream clock to time.Time.
+	Time(ts Timestamp) time.Time
+	// Timestamp converts t to a timestamp of the stream clock.
+	Timestamp(t time.Time) Timestamp
 }
 
-// NewInputStream opens device for the input. The buffersize specifies the number of input events to be
-// buffered waiting to be read.
-func NewInputStream(id DeviceID, bufferSize int,
-	channels ChannelMask, filters ...Filter) (*Stream, error) {
+// baseStream holds the state common to input and output streams.
+type baseStream struct {
+	// stats come first, so the 64-bit counters are aligned for the atomic operations
+	// on 32-bit platforms, the streams embed baseStream after their own 64-bit fields.
+	stats counters
 
-	var stream *pm.PortMidiStream
-	ret := pm.OpenInput(&stream, pm.DeviceID(id), nil, int32(bufferSize), nil, nil)
-	if err := pm.ToError(ret); err != nil {
-		return nil, err
-	}
-	buf := make(chan Event, bufferSize)
-	s := &Stream{
-		stream: stream,
-		closeC: make(chan struct{}),
-		doneC:  make(chan struct{}),
-		buf:    buf,
-	}
-	if channels > 0 { // all allowed by default
-		pm.SetChannelMask(s.stream, int32(channels))
-	}
-	if len(filters) > 0 {
-		var fs Filter
-		fs.Join(filters...)
-		pm.SetFilter(s.stream, int32(fs))
-	}
-	go s.processInput()
-	return s, nil
-}
+	// mux serializes access to the driver stream.
+	mux     sync.Mutex
+	stream  DriverStream
+	closing int32
 
-// NewOutputStream opens device for the input. The buffersize
-// specifies the number of output events to be buffered waiting for output.
-// (In some cases -- see below -- PortMidi does not buffer output at all
-// and merely passes data to a lower-level API, in which case buffersize
-// is ignored.)
-//
-// latency is the delay in milliseconds applied to timestamps to determine
-// when the output should actually occur. (If latency is < 0, 0 is assumed.)
-// If latency is zero, timestamps are ignored and all output is delivered
-// immediately. If latency is greater than zero, output is delayed until the
-// message timestamp plus the latency. (NOTE: the time is measured relative
-// to the time source indicated by time_proc. Timestamps are absolute,
-// not relative delays or offsets.) In some cases, PortMidi can obtain
-// better timing than your application by passing timestamps along to the
-// device driver or hardware. Latency may also help you to synchronize midi
-// data to audio data by matching midi latency to the audio buffer latency.
-func NewOutputStream(id DeviceID, bufferSize, latency int,
-	channels ChannelMask, filters ...Filter) (*Stream, error) {
-	var stream *pm.PortMidiStream
-	ret := pm.OpenOutput(&stream, pm.DeviceID(id), nil, int32(bufferSize), nil, nil, int32(latency))
-	if err := pm.ToError(ret); err != nil {
-		return nil, err
-	}
-	buf := make(chan Event, bufferSize)
-	s := &Stream{
-		stream: stream,
-		closeC: make(chan struct{}),
-		doneC:  make(chan struct{}),
-		buf:    buf,
-	}
-	if channels > 0 { // all allowed by default
-		pm.SetChannelMask(s.stream, int32(channels))
-	}
-	go s.processOutput()
-	return s, nil
+	// id is the current device ID and key identifies the device across rescans,
+	// config is used to reopen the stream, see Rescan. Guarded by mux.
+	id     DeviceID
+	key    DeviceKey
+	config StreamConfig
+	// session the stream belongs to, if any.
+	session *Session
+	// clock is the time source of the stream timestamps.
+	clock Clock
 }
 
-func (s *Stream) pushEvents(buf []pm.Event) {
-	for i := range buf {
-		buf[i].Deref()
-		s.buf <- Event{
-			Timestamp: int32(buf[i].Timestamp),
-			Message:   Message(buf[i].Message),
-		}
-	}
+// beginClose reports whether this is the first call to close the stream.
+func (s *baseStream) beginClose() bool {
+	return atomic.CompareAndSwapInt32(&s.closing, 0, 1)
 }
 
-const pollDelay = 5 * time.Millisecond
-
-func (s *Stream) processInput() {
-	var hadData bool
-	for {
-		select {
-		case <-s.closeC:
-			close(s.buf)
-			close(s.doneC)
-			return
-		default:
-			if pm.Poll(s.stream) == pm.True {
-				hadData = true
-				buf := make([]pm.Event, 128)
-				size := pm.Read(s.stream, buf, 128)
-				s.pushEvents(buf[:size])
-				continue
-			} else if hadData {
-				hadData = false
-				continue
-			}
-			time.Sleep(pollDelay)
-		}
-	}
+// closeStream closes the driver stream.
+func (s *baseStream) closeStream() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	err := s.wrap("close", s.stream.Close())
+	s.stream = nil
+	return err
 }
 
-// An aggregating version of this function available:
-// https://gist.github.com/xlab/1768c3dd210bf3829b54f4cec3f748bb
-func (s *Stream) processOutput() {
-	for {
-		select {
-		case <-s.closeC:
-			go func() {
-				// drain s.buf
-				for range s.buf {
-				}
-			}()
-			close(s.doneC)
-			return
-		case ev, ok := <-s.buf:
-			if !ok { // s.buf closed
-				close(s.doneC)
-				return
-			}
-			if len(ev.SysExData) > 0 { // handle sysEx separately
-				pm.WriteSysEx(s.stream, pm.Timestamp(ev.Timestamp), ev.SysExData)
-				continue
-			}
-			pm.WriteShort(s.stream, pm.Timestamp(ev.Timestamp), int32(ev.Message))
-		}
-	}
+// DeviceID returns the ID of the device, it may change after Rescan.
+func (s *baseStream) DeviceID() DeviceID {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.id
 }
 
 // HasHostError tests whether stream has a pending host error.
 // Normally, the client finds out about errors through returned error codes,
 // but some errors can occur asynchronously where the client does not
 // explicitly call a function, and therefore cannot receive an error code.
-func (s *Stream) HasHostError() bool {
-	return pm.HasHostError(s.stream) > 0
+func (s *baseStream) HasHostError() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.stream == nil {
+		return false
+	}
+	return s.stream.HasHostError()
 }
-
-// Synchronize instructs PortMidi to (re)synchronize to the
-// time_proc passed when the stream was opened.
-// PortMidi will always synchronize at the
-// first output message and periodically thereafter.
-// func (s *Stream) Sync() error {
-// 	return pm.ToError(pm.Synchronize(s.stream))
-// }
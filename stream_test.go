@@ -0,0 +1,74 @@
+package portmidi
+
+import (
+	"context"
+	"testing"
+)
+
+// BenchmarkLoopback measures an event sent through Sink and received from Source,
+// the steady state must not allocate.
+func BenchmarkLoopback(b *testing.B) {
+	drv := useVirtualDriver(b)
+	out, in := openLoopback(b, drv, WithBufferSize(1024))
+	defer in.Close()
+	defer out.Close()
+	sink, source := out.Sink(), in.Source()
+	msg := NewMessage(0xB0, 1, 2)
+	for i := 0; i < 100; i++ { // warm up the buffers
+		sink <- Event{Message: msg}
+		<-source
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sink <- Event{Message: msg}
+		<-source
+	}
+}
+
+// BenchmarkWriteRead measures batches of events passed to Write and received with Read.
+func BenchmarkWriteRead(b *testing.B) {
+	drv := useVirtualDriver(b)
+	out, in := openLoopback(b, drv, WithBufferSize(1024))
+	defer in.Close()
+	defer out.Close()
+	ctx := context.Background()
+	events := make([]Event, 64)
+	for i := range events {
+		events[i].Message = NewMessage(0x90, byte(i), 100)
+	}
+	buf := make([]Event, len(events))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := out.Write(ctx, events...); err != nil {
+			b.Fatal(err)
+		}
+		for n := 0; n < len(events); {
+			m, err := in.Read(ctx, buf[n:])
+			if err != nil {
+				b.Fatal(err)
+			}
+			n += m
+		}
+	}
+}
+
+func TestLoopbackAllocs(t *testing.T) {
+	drv := useVirtualDriver(t)
+	out, in := openLoopback(t, drv, WithBufferSize(1024))
+	defer in.Close()
+	defer out.Close()
+	sink, source := out.Sink(), in.Source()
+	msg := NewMessage(0xB0, 1, 2)
+	for i := 0; i < 100; i++ {
+		sink <- Event{Message: msg}
+		<-source
+	}
+	if n := testing.AllocsPerRun(1000, func() {
+		sink <- Event{Message: msg}
+		<-source
+	}); n > 0 {
+		t.Errorf("%v allocations per event, want 0", n)
+	}
+}
@@ -0,0 +1,177 @@
+package portmidi
+
+import "errors"
+
+const (
+	sysExStart = 0xF0
+	sysExEnd   = 0xF7
+)
+
+var (
+	// ErrSysExAborted means a SysEx message has been interrupted by a status byte
+	// other than a real-time message before its EOX (0xF7).
+	ErrSysExAborted = errors.New("portmidi: sysex message aborted")
+	// ErrSysExTruncated means the input ended before a SysEx message
+	// has been terminated by EOX (0xF7), or the message exceeded the SysEx
+	// buffer size of the stream.
+	ErrSysExTruncated = errors.New("portmidi: sysex message truncated")
+)
+
+// sysExAssembler reassembles SysEx messages from raw input events that carry
+// 4 bytes of SysEx data per Message. Real-time messages interleaved with the
+// data are passed through as separate events.
+type sysExAssembler struct {
+	data      []byte
+	timestamp Timestamp
+	active    bool
+	// limit is the maximum size of a message including F0 and F7, zero means no limit.
+	// The rest of a message that exceeds the limit is skipped.
+	limit int
+	skip  bool
+}
+
+// feed processes a raw event and appends the resulting events to out.
+func (a *sysExAssembler) feed(out []Event, ev Event) []Event {
+	if a.skip {
+		return a.skipRest(out, ev, 0)
+	}
+	status := ev.Message.Status()
+	if !a.active {
+		if status < 0x80 {
+			// the rest of a SysEx message flushed by the driver, e.g. after an overflow
+			return out
+		}
+		if status != sysExStart {
+			return append(out, ev)
+		}
+		a.begin(ev.Timestamp)
+	} else if status >= 0xF8 {
+		// real-time message is delivered as a separate event
+		return append(out, ev)
+	}
+	for i := uint(0); i < 4; i++ {
+		b := byte(ev.Message >> (8 * i))
+		switch {
+		case b < 0x80:
+			a.data = append(a.data, b)
+			if a.limit > 0 && len(a.data) >= a.limit {
+				// no room left for EOX
+				out = append(out, a.end(ErrSysExTruncated))
+				a.skip = true
+				return a.skipRest(out, ev, i+1)
+			}
+			continue
+		case b == sysExStart && len(a.data) == 0:
+			a.data = append(a.data, b)
+			continue
+		case b == sysExEnd:
+			a.data = append(a.data, b)
+			return append(out, a.end(nil))
+		case b >= 0xF8:
+			out = append(out, Event{
+				Timestamp: ev.Timestamp,
+				Message:   Message(b),
+			})
+			continue
+		}
+		// any other status byte aborts the message
+		out = append(out, a.end(ErrSysExAborted))
+		if i == 0 {
+			// a complete message that follows the aborted one
+			return a.feed(out, ev)
+		}
+		if b == sysExStart {
+			a.begin(ev.Timestamp)
+			a.data = append(a.data, b)
+			continue
+		}
+		return out
+	}
+	return out
+}
+
+// skipRest drops the rest of a truncated SysEx message starting from the byte from of ev.
+func (a *sysExAssembler) skipRest(out []Event, ev Event, from uint) []Event {
+	for i := from; i < 4; i++ {
+		b := byte(ev.Message >> (8 * i))
+		switch {
+		case b < 0x80:
+			continue
+		case b >= 0xF8:
+			out = append(out, Event{
+				Timestamp: ev.Timestamp,
+				Message:   Message(b),
+			})
+			continue
+		}
+		a.skip = false
+		if i == 0 && b != sysExEnd {
+			// a complete message that follows the truncated one
+			return a.feed(out, ev)
+		}
+		return out
+	}
+	return out
+}
+
+// flush terminates a pending SysEx message, if any, appending it with err to out.
+func (a *sysExAssembler) flush(out []Event, err error) []Event {
+	if !a.active {
+		return out
+	}
+	return append(out, a.end(err))
+}
+
+// discard drops a pending SysEx message.
+func (a *sysExAssembler) discard() {
+	a.active = false
+	a.skip = false
+	a.data = nil
+}
+
+func (a *sysExAssembler) begin(timestamp Timestamp) {
+	a.active = true
+	a.timestamp = timestamp
+	a.data = nil
+}
+
+func (a *sysExAssembler) end(err error) Event {
+	ev := Event{
+		Timestamp: a.timestamp,
+		Message:   Message(sysExStart),
+		SysExData: a.data,
+		Err:       err,
+	}
+	a.active = false
+	a.data = nil
+	return ev
+}
+
+// appendSysEx packs SysEx data into events by 4 bytes per Message, the way PortMidi
+// represents SysEx messages in a stream of events.
+func appendSysEx(buf []Event, timestamp Timestamp, data []byte) []Event {
+	for i := 0; i < len(data); i += 4 {
+		var msg Message
+		for j := 0; j < 4 && i+j < len(data); j++ {
+			msg |= Message(data[i+j]) << (8 * uint(j))
+		}
+		buf = append(buf, Event{
+			Timestamp: timestamp,
+			Message:   msg,
+		})
+	}
+	return buf
+}
+
+// validSysEx reports whether data is a complete SysEx message: F0, 7-bit data bytes and F7.
+func validSysEx(data []byte) bool {
+	if len(data) < 2 || data[0] != sysExStart || data[len(data)-1] != sysExEnd {
+		return false
+	}
+	for _, b := range data[1 : len(data)-1] {
+		if b >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
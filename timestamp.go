@@ -0,0 +1,48 @@
+package portmidi
+
+import "time"
+
+// Timestamp is a time in milliseconds of the clock of a stream, see Clock. Timestamps wrap
+// around after about 24 days, so compare them with Before and Sub rather than < and -.
+type Timestamp int32
+
+// Before reports whether t is before u, it is correct across the wraparound as long as
+// the timestamps are less than about 24 days apart, like PmBefore of PortMidi.
+func (t Timestamp) Before(u Timestamp) bool {
+	return t-u < 0
+}
+
+// Sub returns the duration t-u, it is correct across the wraparound.
+func (t Timestamp) Sub(u Timestamp) time.Duration {
+	return time.Duration(t-u) * time.Millisecond
+}
+
+// Add returns the timestamp t+d, d is truncated to milliseconds.
+func (t Timestamp) Add(d time.Duration) Timestamp {
+	return t + Timestamp(d/time.Millisecond)
+}
+
+// clockTime converts a timestamp of clock to time.Time anchored to the current time
+// of both clocks, so the result is accurate to a millisecond.
+func clockTime(clock Clock, ts Timestamp) time.Time {
+	now, wall := clock.Now(), time.Now()
+	return wall.Add(ts.Sub(now))
+}
+
+// clockTimestamp converts t to a timestamp of clock, see clockTime.
+func clockTimestamp(clock Clock, t time.Time) Timestamp {
+	now, wall := clock.Now(), time.Now()
+	return now.Add(t.Sub(wall))
+}
+
+// Time converts a timestamp of the stream clock to time.Time, e.g. the Timestamp of
+// a received event. The result is accurate to a millisecond.
+func (s *baseStream) Time(ts Timestamp) time.Time {
+	return clockTime(s.clock, ts)
+}
+
+// Timestamp converts t to a timestamp of the stream clock, e.g. to schedule an event
+// written to an output at t. The result is accurate to a millisecond.
+func (s *baseStream) Timestamp(t time.Time) Timestamp {
+	return clockTimestamp(s.clock, t)
+}
@@ -0,0 +1,70 @@
+package portmidi
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTimestampWraparound(t *testing.T) {
+	const max = math.MaxInt32
+	tests := []struct {
+		t, u   Timestamp
+		before bool
+		sub    time.Duration
+	}{
+		{0, 1, true, -time.Millisecond},
+		{1, 0, false, time.Millisecond},
+		{5, 5, false, 0},
+		{max - 1, max, true, -time.Millisecond},
+		{max, -max - 1, true, -time.Millisecond}, // the next millisecond wraps around
+		{-max - 1, max, false, time.Millisecond},
+		{max - 10, -max + 8, true, -20 * time.Millisecond},
+		{-5, 5, true, -10 * time.Millisecond},
+		{5, -5, false, 10 * time.Millisecond},
+		{-10, -20, false, 10 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := tt.t.Before(tt.u); got != tt.before {
+			t.Errorf("%d.Before(%d): got %v, want %v", tt.t, tt.u, got, tt.before)
+		}
+		if got := tt.t.Sub(tt.u); got != tt.sub {
+			t.Errorf("%d.Sub(%d): got %v, want %v", tt.t, tt.u, got, tt.sub)
+		}
+		if got := tt.u.Add(tt.sub); got != tt.t {
+			t.Errorf("%d.Add(%v): got %d, want %d", tt.u, tt.sub, got, tt.t)
+		}
+	}
+	if got := Timestamp(max - 1).Add(1500 * time.Microsecond); got != max {
+		t.Errorf("Add truncates to milliseconds: got %d, want %d", got, Timestamp(max))
+	}
+	if got := Timestamp(-max).Add(-3 * time.Millisecond); got != max-1 {
+		t.Errorf("Add wraps around backwards: got %d, want %d", got, Timestamp(max-1))
+	}
+}
+
+func TestStreamTimestamp(t *testing.T) {
+	drv := useVirtualDriver(t)
+	inID := drv.AddInput("In")
+	for _, base := range []Timestamp{0, -1000, math.MaxInt32 - 5} {
+		goClock := NewGoClock()
+		clock := ClockFunc(func() Timestamp { return goClock.Now() + base })
+		in, err := OpenInput(inID, WithClock(clock))
+		if err != nil {
+			t.Fatal(err)
+		}
+		now := time.Now()
+		for _, d := range []time.Duration{0, 10 * time.Millisecond, -10 * time.Millisecond, time.Hour} {
+			ts := in.Timestamp(now.Add(d))
+			if got := ts.Sub(clock.Now()); got < d-2*time.Millisecond || got > d+2*time.Millisecond {
+				t.Errorf("base %d: Timestamp of now%+v is %v from the clock", base, d, got)
+			}
+			if got := in.Time(ts).Sub(now); got < d-2*time.Millisecond || got > d+2*time.Millisecond {
+				t.Errorf("base %d: round trip of now%+v gives now%+v", base, d, got)
+			}
+		}
+		if err := in.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,441 @@
+package portmidi
+
+import (
+	"sync"
+	"time"
+
+	"github.com/xlab/portmidi/pm"
+)
+
+// VirtualInterface is the interface name reported for devices of a VirtualDriver.
+const VirtualInterface = "Virtual"
+
+// VirtualDriver is an in-memory Driver that needs neither MIDI hardware nor PortMidi,
+// so the code built on top of streams can be tested end to end. Devices are declared
+// with AddInput and AddOutput, an output device can be connected to any number of inputs
+// so everything written to the output is received by the connected inputs, see Connect.
+//
+//	drv := portmidi.NewVirtualDriver()
+//	out, in := drv.AddLoopback("Loop")
+//	portmidi.SetDriver(drv)
+//
+// Like PortMidi, the driver timestamps input events with the stream clock, or its own
+// clock measured in milliseconds since the driver has been created.
+type VirtualDriver struct {
+	mux     sync.Mutex
+	start   time.Time
+	devices []*virtualDevice
+	// hostError is the text of the last host error, like in PortMidi it is cleared when read.
+	hostError string
+}
+
+type virtualDevice struct {
+	info    DeviceInfo
+	targets []*virtualDevice
+	stream  *virtualStream
+	removed bool
+}
+
+// NewVirtualDriver creates a virtual driver with no devices.
+func NewVirtualDriver() *VirtualDriver {
+	return &VirtualDriver{
+		start: time.Now(),
+	}
+}
+
+// AddInput declares a virtual input device and returns its ID.
+func (d *VirtualDriver) AddInput(name string) DeviceID {
+	return d.addDevice(DeviceInfo{
+		Interface:        VirtualInterface,
+		Name:             name,
+		IsInputAvailable: true,
+	})
+}
+
+// AddOutput declares a virtual output device and returns its ID.
+func (d *VirtualDriver) AddOutput(name string) DeviceID {
+	return d.addDevice(DeviceInfo{
+		Interface:         VirtualInterface,
+		Name:              name,
+		IsOutputAvailable: true,
+	})
+}
+
+// AddLoopback declares a pair of virtual devices with the same name,
+// everything written to the output device is received by the input device.
+func (d *VirtualDriver) AddLoopback(name string) (out, in DeviceID) {
+	out = d.AddOutput(name)
+	in = d.AddInput(name)
+	d.Connect(out, in)
+	return out, in
+}
+
+func (d *VirtualDriver) addDevice(info DeviceInfo) DeviceID {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.devices = append(d.devices, &virtualDevice{
+		info: info,
+	})
+	return DeviceID(len(d.devices) - 1)
+}
+
+// Connect routes everything written to the output device out into the input device in.
+func (d *VirtualDriver) Connect(out, in DeviceID) error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	outDev := d.device(out)
+	inDev := d.device(in)
+	if outDev == nil || inDev == nil ||
+		!outDev.info.IsOutputAvailable || !inDev.info.IsInputAvailable {
+		return pm.ErrInvalidDeviceID
+	}
+	outDev.targets = append(outDev.targets, inDev)
+	return nil
+}
+
+// Send injects events into the input device as if they were received from hardware,
+// events having SysExData are delivered the same way PortMidi delivers SysEx messages.
+func (d *VirtualDriver) Send(in DeviceID, events ...Event) error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	dev := d.device(in)
+	if dev == nil || !dev.info.IsInputAvailable {
+		return pm.ErrInvalidDeviceID
+	}
+	if dev.stream != nil {
+		dev.stream.deliver(events)
+	}
+	return nil
+}
+
+// Remove unplugs the device, the IDs of the devices declared after it shift down like after
+// a rescan of PortMidi devices. An open stream of the removed device stays open, but receives
+// nothing and reports a host error, until it is closed or reopened, see Rescan.
+func (d *VirtualDriver) Remove(id DeviceID) error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	dev := d.device(id)
+	if dev == nil {
+		return pm.ErrInvalidDeviceID
+	}
+	dev.removed = true
+	d.devices = append(d.devices[:id], d.devices[id+1:]...)
+	for _, other := range d.devices {
+		for i := 0; i < len(other.targets); i++ {
+			if other.targets[i] == dev {
+				other.targets = append(other.targets[:i], other.targets[i+1:]...)
+				i--
+			}
+		}
+	}
+	return nil
+}
+
+func (d *VirtualDriver) device(id DeviceID) *virtualDevice {
+	if id < 0 || int(id) >= len(d.devices) {
+		return nil
+	}
+	return d.devices[id]
+}
+
+// Time returns milliseconds elapsed since the driver has been created.
+func (d *VirtualDriver) Time() Timestamp {
+	return Timestamp(time.Since(d.start) / time.Millisecond)
+}
+
+func (d *VirtualDriver) Initialize() error {
+	return nil
+}
+
+func (d *VirtualDriver) Terminate() error {
+	return nil
+}
+
+func (d *VirtualDriver) CountDevices() int {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return len(d.devices)
+}
+
+func (d *VirtualDriver) DeviceInfo(id DeviceID) *DeviceInfo {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	dev := d.device(id)
+	if dev == nil {
+		return nil
+	}
+	info := dev.info
+	info.IsOpened = dev.stream != nil
+	return &info
+}
+
+func (d *VirtualDriver) DefaultInputDeviceID() (DeviceID, bool) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	for i, dev := range d.devices {
+		if dev.info.IsInputAvailable {
+			return DeviceID(i), true
+		}
+	}
+	return 0, false
+}
+
+func (d *VirtualDriver) DefaultOutputDeviceID() (DeviceID, bool) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	for i, dev := range d.devices {
+		if dev.info.IsOutputAvailable {
+			return DeviceID(i), true
+		}
+	}
+	return 0, false
+}
+
+func (d *VirtualDriver) HostErrorText() string {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	text := d.hostError
+	d.hostError = ""
+	return text
+}
+
+func (d *VirtualDriver) OpenInput(id DeviceID, config StreamConfig) (DriverStream, error) {
+	return d.open(id, config.BufferSize, config.Clock, true)
+}
+
+func (d *VirtualDriver) OpenOutput(id DeviceID, config StreamConfig) (DriverStream, error) {
+	return d.open(id, config.BufferSize, config.Clock, false)
+}
+
+func (d *VirtualDriver) open(id DeviceID, bufferSize int, clock Clock, input bool) (DriverStream, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	dev := d.device(id)
+	switch {
+	case dev == nil, dev.stream != nil,
+		input && !dev.info.IsInputAvailable,
+		!input && !dev.info.IsOutputAvailable:
+		return nil, pm.ErrInvalidDeviceID
+	}
+	if bufferSize <= 0 {
+		bufferSize = pm.DefaultSysexBufferSize
+	}
+	if clock == nil {
+		clock = ClockFunc(d.Time)
+	}
+	dev.stream = &virtualStream{
+		drv:     d,
+		dev:     dev,
+		clock:   clock,
+		size:    bufferSize,
+		filters: FilterActive, // PortMidi default
+		mask:    0xFFFF,
+	}
+	return dev.stream, nil
+}
+
+// virtualStream is a DriverStream of a virtual device.
+type virtualStream struct {
+	drv      *VirtualDriver
+	dev      *virtualDevice
+	clock    Clock
+	size     int
+	queue    []Event
+	overflow bool
+	filters  Filter
+	mask     ChannelMask
+	closed   bool
+	sysEx    sysExAssembler
+	events   []Event
+	notify   func()
+
+	hostErrorReported bool
+}
+
+// deliver puts events into the input queue, d.mux must be held.
+func (v *virtualStream) deliver(events []Event) {
+	if v.notify != nil {
+		defer v.notify()
+	}
+	now := v.clock.Now()
+	for _, ev := range events {
+		if len(ev.SysExData) > 0 {
+			if v.filters&FilterSysEx != 0 {
+				continue
+			}
+			for _, raw := range appendSysEx(nil, now, ev.SysExData) {
+				if !v.push(raw) {
+					break // remainder of SysEx is flushed as well
+				}
+			}
+			continue
+		}
+		if v.filtered(ev.Message) {
+			continue
+		}
+		v.push(Event{
+			Timestamp: now,
+			Message:   ev.Message,
+		})
+	}
+}
+
+// push appends to the queue, on overflow the queue is flushed like PortMidi does.
+func (v *virtualStream) push(ev Event) bool {
+	if len(v.queue) >= v.size {
+		v.queue = v.queue[:0]
+		v.overflow = true
+		return false
+	}
+	v.queue = append(v.queue, ev)
+	return true
+}
+
+func (v *virtualStream) filtered(msg Message) bool {
+	status := msg.Status()
+	if status >= 0xF0 {
+		return v.filters&(1<<(status-0xF0)) != 0
+	}
+	if v.mask&(1<<(status&0x0F)) == 0 {
+		return true
+	}
+	return v.filters&(1<<(0x10+(status>>4))) != 0
+}
+
+func (v *virtualStream) setNotify(fn func()) {
+	v.drv.mux.Lock()
+	defer v.drv.mux.Unlock()
+	v.notify = fn
+}
+
+func (v *virtualStream) Poll() (bool, error) {
+	v.drv.mux.Lock()
+	defer v.drv.mux.Unlock()
+	if v.closed {
+		return false, pm.ErrBadPtr
+	}
+	if v.dev.removed && !v.hostErrorReported {
+		// like Pm_Poll, report the host error of the input
+		v.hostErrorReported = true
+		v.setHostError()
+		return false, pm.ErrHostError
+	}
+	return len(v.queue) > 0 || v.overflow, nil
+}
+
+func (v *virtualStream) Read(buf []Event) (int, error) {
+	v.drv.mux.Lock()
+	defer v.drv.mux.Unlock()
+	if v.closed {
+		return 0, pm.ErrBadPtr
+	}
+	if v.overflow {
+		v.overflow = false
+		return 0, pm.ErrBufferOverflow
+	}
+	n := copy(buf, v.queue)
+	v.queue = v.queue[:copy(v.queue, v.queue[n:])]
+	return n, nil
+}
+
+func (v *virtualStream) Write(buf []Event) error {
+	v.events = v.events[:0]
+	for i := range buf {
+		v.events = v.sysEx.feed(v.events, buf[i])
+	}
+	for i := range v.events {
+		if v.events[i].Err != nil {
+			return pm.ErrBadData
+		}
+	}
+	return v.write(v.events...)
+}
+
+func (v *virtualStream) WriteShort(timestamp Timestamp, msg Message) error {
+	return v.write(Event{
+		Timestamp: timestamp,
+		Message:   msg,
+	})
+}
+
+func (v *virtualStream) WriteSysEx(timestamp Timestamp, data []byte) error {
+	if len(data) < 2 || data[0] != sysExStart || data[len(data)-1] != sysExEnd {
+		return pm.ErrBadData
+	}
+	return v.write(Event{
+		Timestamp: timestamp,
+		Message:   Message(sysExStart),
+		SysExData: append([]byte(nil), data...),
+	})
+}
+
+func (v *virtualStream) write(events ...Event) error {
+	v.drv.mux.Lock()
+	defer v.drv.mux.Unlock()
+	if v.closed {
+		return pm.ErrBadPtr
+	}
+	if !v.dev.info.IsOutputAvailable {
+		return pm.ErrBadPtr
+	}
+	if v.dev.removed {
+		v.setHostError()
+		return pm.ErrHostError
+	}
+	for _, target := range v.dev.targets {
+		if in := target.stream; in != nil {
+			in.deliver(events)
+		}
+	}
+	return nil
+}
+
+func (v *virtualStream) SetFilter(filters Filter) error {
+	v.drv.mux.Lock()
+	defer v.drv.mux.Unlock()
+	v.filters = filters
+	return nil
+}
+
+func (v *virtualStream) SetChannelMask(mask ChannelMask) error {
+	v.drv.mux.Lock()
+	defer v.drv.mux.Unlock()
+	v.mask = mask
+	return nil
+}
+
+// HasHostError reports the removal of the device once, the way PortMidi reports a host error.
+func (v *virtualStream) HasHostError() bool {
+	v.drv.mux.Lock()
+	defer v.drv.mux.Unlock()
+	if !v.dev.removed || v.hostErrorReported {
+		return false
+	}
+	v.hostErrorReported = true
+	v.setHostError()
+	return true
+}
+
+// setHostError sets the host error text of the driver, d.mux must be held.
+func (v *virtualStream) setHostError() {
+	v.drv.hostError = "device " + v.dev.info.Name + " has been removed"
+}
+
+func (v *virtualStream) Abort() error {
+	return nil
+}
+
+func (v *virtualStream) Synchronize() error {
+	return nil
+}
+
+func (v *virtualStream) Close() error {
+	v.drv.mux.Lock()
+	defer v.drv.mux.Unlock()
+	if v.closed {
+		return pm.ErrBadPtr
+	}
+	v.closed = true
+	v.dev.stream = nil
+	return nil
+}
@@ -0,0 +1,206 @@
+package portmidi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/xlab/portmidi/pm"
+)
+
+// useVirtualDriver makes the package use a new VirtualDriver for the duration of the test.
+func useVirtualDriver(tb testing.TB) *VirtualDriver {
+	drv := NewVirtualDriver()
+	useDriver(tb, drv)
+	return drv
+}
+
+// useDriver makes the package use drv for the duration of the test.
+func useDriver(tb testing.TB, drv Driver) {
+	SetDriver(drv)
+	if err := Initialize(); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		if err := Terminate(); err != nil {
+			tb.Error(err)
+		}
+		SetDriver(nil)
+	})
+}
+
+// receive returns the next event of the input or fails the test after a second.
+func receive(tb testing.TB, in *InputStream) Event {
+	tb.Helper()
+	select {
+	case ev, ok := <-in.Source():
+		if !ok {
+			tb.Fatal("input closed")
+		}
+		return ev
+	case <-time.After(time.Second):
+		tb.Fatal("no event received")
+	}
+	return Event{}
+}
+
+func openLoopback(tb testing.TB, drv *VirtualDriver, opts ...Option) (*OutputStream, *InputStream) {
+	tb.Helper()
+	outID, inID := drv.AddLoopback("Loop")
+	in, err := OpenInput(inID)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	out, err := OpenOutput(outID, opts...)
+	if err != nil {
+		in.Close()
+		tb.Fatal(err)
+	}
+	return out, in
+}
+
+func TestLoopbackSink(t *testing.T) {
+	drv := useVirtualDriver(t)
+	out, in := openLoopback(t, drv)
+	defer in.Close()
+	defer out.Close()
+
+	note := NewMessage(0x90, 60, 100)
+	sysEx := []byte{0xF0, 0x7E, 0x7F, 0x06, 0x01, 0xF7}
+	out.Sink() <- Event{Message: note}
+	out.Sink() <- Event{SysExData: sysEx}
+	if ev := receive(t, in); ev.Message != note || ev.Err != nil {
+		t.Errorf("got %v, want note %v", ev, note)
+	}
+	if ev := receive(t, in); !bytes.Equal(ev.SysExData, sysEx) || ev.Err != nil {
+		t.Errorf("got %v, want SysEx % X", ev, sysEx)
+	}
+}
+
+func TestLoopbackReadWrite(t *testing.T) {
+	drv := useVirtualDriver(t)
+	out, in := openLoopback(t, drv)
+	ctx := context.Background()
+	events := []Event{
+		{Message: NewMessage(0xC0, 5, 0)},
+		{SysExData: []byte{0xF0, 1, 2, 3, 4, 5, 0xF7}},
+		{Message: NewMessage(0x80, 60, 0)},
+	}
+	if err := out.Write(ctx, events...); err != nil {
+		t.Fatal(err)
+	}
+	var got []Event
+	buf := make([]Event, 8)
+	for len(got) < len(events) {
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		n, err := in.Read(ctx, buf)
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, buf[:n]...)
+	}
+	for i, want := range events {
+		if want.SysExData == nil && got[i].Message != want.Message ||
+			!bytes.Equal(got[i].SysExData, want.SysExData) {
+			t.Errorf("event %d: got %v, want %v", i, got[i], want)
+		}
+	}
+
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Write(ctx, Event{Message: NewMessage(0x90, 1, 1)}); err != ErrClosed {
+		t.Errorf("write after close: got %v, want ErrClosed", err)
+	}
+	if _, err := in.Read(ctx, buf); err != io.EOF {
+		t.Errorf("read after close: got %v, want io.EOF", err)
+	}
+	if err := in.Close(); err != ErrClosed {
+		t.Errorf("second close: got %v, want ErrClosed", err)
+	}
+}
+
+func TestVirtualOpen(t *testing.T) {
+	drv := useVirtualDriver(t)
+	inID := drv.AddInput("In")
+	outID := drv.AddOutput("Out")
+
+	if _, err := OpenInput(outID); err == nil {
+		t.Error("opened an output device for the input")
+	}
+	if _, err := OpenOutput(inID); err == nil {
+		t.Error("opened an input device for the output")
+	}
+	if _, err := OpenInput(DeviceID(5)); err == nil {
+		t.Error("opened a device that does not exist")
+	}
+	in, err := OpenInput(inID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !GetDeviceInfo(inID).IsOpened {
+		t.Error("device of an open stream is not reported as opened")
+	}
+	if _, err := OpenInput(inID); err == nil {
+		t.Error("opened a device twice")
+	}
+	if err := in.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if GetDeviceInfo(inID).IsOpened {
+		t.Error("device of a closed stream is reported as opened")
+	}
+}
+
+func TestVirtualSendFilter(t *testing.T) {
+	drv := useVirtualDriver(t)
+	inID := drv.AddInput("In")
+	in, err := OpenInput(inID, WithFilter(FilterNote), WithChannelMask(Channel(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	drv.Send(inID,
+		Event{Message: NewMessage(0x91, 60, 100)}, // note, filtered
+		Event{Message: NewMessage(0xB0, 7, 100)},  // channel 0, masked
+		Event{Message: NewMessage(0xB1, 7, 100)},
+	)
+	if ev := receive(t, in); ev.Message != NewMessage(0xB1, 7, 100) {
+		t.Errorf("got %v, want the control change on channel 1", ev)
+	}
+}
+
+func TestVirtualOverflow(t *testing.T) {
+	drv := useVirtualDriver(t)
+	inID := drv.AddInput("In")
+	in, err := OpenInput(inID, WithBufferSize(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	var burst []Event
+	for i := 0; i < 8; i++ {
+		burst = append(burst, Event{Message: NewMessage(0x90, byte(i), 1)})
+	}
+	drv.Send(inID, burst...) // twice the driver buffer at once
+	for {
+		ev := receive(t, in)
+		if ev.Err == nil {
+			continue
+		}
+		if !errors.Is(ev.Err, pm.ErrBufferOverflow) {
+			t.Fatalf("got error %v, want buffer overflow", ev.Err)
+		}
+		break
+	}
+	if n := in.Overflows(); n != 1 {
+		t.Errorf("got %d overflows, want 1", n)
+	}
+}